@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/cantart/upsert-benchmark/upsert"
+)
+
+func TestParseFlags(t *testing.T) {
+	cfg, err := parseFlags([]string{"--source-table", "legacy.users", "--table", "users", "--keys", "id", "--dsn", "postgres://dest"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.sourceDSN != "postgres://dest" {
+		t.Fatalf("sourceDSN = %q, want destination DSN", cfg.sourceDSN)
+	}
+	if !reflect.DeepEqual(cfg.sourceKeys, []string{"id"}) {
+		t.Fatalf("sourceKeys = %v, want [id]", cfg.sourceKeys)
+	}
+	other := cfg
+	other.table = "users_copy"
+	if cfg.jobID() == other.jobID() {
+		t.Fatalf("jobID() = %q for both destinations", cfg.jobID())
+	}
+}
+
+func TestSyncCheckpointRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := upsert.NewFileCheckpointStore(t.TempDir())
+
+	cp := upsert.Checkpoint{JobID: "sync_test", Offset: 42, Batches: 1, State: upsert.JobRunning}
+	if err := saveSync(ctx, store, cp, []any{"acme", int64(9007199254740993)}); err != nil {
+		t.Fatalf("saveSync: %v", err)
+	}
+	loaded, found, err := store.Load(ctx, "sync_test")
+	if err != nil || !found {
+		t.Fatalf("Load = found %v, err %v", found, err)
+	}
+	key, err := decodeKey(loaded.Position)
+	if err != nil {
+		t.Fatalf("decodeKey: %v", err)
+	}
+	if want := []any{"acme", json.Number("9007199254740993")}; !reflect.DeepEqual(key, want) {
+		t.Fatalf("last key = %#v, want %#v", key, want)
+	}
+	if loaded.Offset != 42 || loaded.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected checkpoint: %+v", loaded)
+	}
+
+	if _, err := decodeKey("[]"); err == nil {
+		t.Fatal("expected error for empty key, got nil")
+	}
+}
+
+func TestParseFlags_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "noSource", args: []string{"--table", "users", "--keys", "id"}},
+		{name: "bothSources", args: []string{"--source-table", "a", "--source-query", "SELECT 1", "--table", "users", "--keys", "id"}},
+		{name: "columnsWithQuery", args: []string{"--source-query", "SELECT 1", "--columns", "id", "--table", "users", "--keys", "id"}},
+		{name: "missingKeys", args: []string{"--source-table", "a", "--table", "users"}},
+		{name: "badPageSize", args: []string{"--source-table", "a", "--table", "users", "--keys", "id", "--page-size", "0"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseFlags(tc.args, io.Discard); err == nil {
+				t.Fatalf("parseFlags(%v) expected error, got nil", tc.args)
+			}
+		})
+	}
+}
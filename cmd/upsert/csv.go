@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/cantart/upsert-benchmark/source"
+	"github.com/cantart/upsert-benchmark/upsert"
+)
+
+func loadCSV(ctx context.Context, db *sql.DB, upserter upsert.Upserter, cfg config, input io.Reader, stderr io.Writer) error {
+	reader, err := source.NewCSV(input)
+	if err != nil {
+		return err
+	}
+
+	convert := newConverter(ctx, db, cfg, reader.Columns(), stderr)
+	return loadRows(ctx, upserter, cfg, reader, convert)
+}
+
+// newConverter returns a function that replaces NULL markers in rows in place. Column
+// types are introspected so that empty fields only become NULL where an empty string
+// is not a valid value; if introspection fails every empty field is treated as NULL.
+func newConverter(ctx context.Context, db *sql.DB, cfg config, columns []string, stderr io.Writer) func([][]any) {
+	nullable := make([]bool, len(columns))
+	for i := range nullable {
+		nullable[i] = true
+	}
+
+	if cfg.null == "" {
+		info, err := upsert.IntrospectColumns(ctx, db, cfg.table)
+		if err != nil {
+			fmt.Fprintf(stderr, "upsert: %v; treating empty fields as NULL\n", err)
+		} else {
+			textual := make(map[string]bool, len(info))
+			for _, col := range info {
+				textual[col.Name] = col.IsTextual()
+			}
+			for i, col := range columns {
+				nullable[i] = !textual[col]
+			}
+		}
+	}
+
+	return func(rows [][]any) {
+		for _, row := range rows {
+			for i, value := range row {
+				if nullable[i] && value == cfg.null {
+					row[i] = nil
+				}
+			}
+		}
+	}
+}
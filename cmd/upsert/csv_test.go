@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNewConverter_IntrospectedTypes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM information_schema.columns")).
+		WithArgs("users", "").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "udt_name", "nullable", "max_length", "precision", "scale"}).
+			AddRow("id", "bigint", "int8", false, 0, 64, 0).
+			AddRow("name", "text", "text", true, 0, 0, 0))
+
+	convert := newConverter(context.Background(), db, config{table: "users"}, []string{"id", "name"}, io.Discard)
+
+	rows := [][]any{{"", ""}, {"1", "John"}}
+	convert(rows)
+	if want := [][]any{{nil, ""}, {"1", "John"}}; !reflect.DeepEqual(rows, want) {
+		t.Fatalf("converted rows = %v, want %v", rows, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestNewConverter_NullMarker(t *testing.T) {
+	convert := newConverter(context.Background(), nil, config{table: "users", null: `\N`}, []string{"id", "name"}, io.Discard)
+
+	rows := [][]any{{"1", `\N`}, {"2", ""}}
+	convert(rows)
+	if want := [][]any{{"1", nil}, {"2", ""}}; !reflect.DeepEqual(rows, want) {
+		t.Fatalf("converted rows = %v, want %v", rows, want)
+	}
+}
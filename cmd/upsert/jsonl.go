@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cantart/upsert-benchmark/source"
+	"github.com/cantart/upsert-benchmark/upsert"
+)
+
+func loadJSONL(ctx context.Context, upserter upsert.Upserter, cfg config, input io.Reader, stderr io.Writer) error {
+	var mapping map[string]string
+	if cfg.mapping != "" {
+		var err error
+		if mapping, err = source.LoadMapping(cfg.mapping); err != nil {
+			return err
+		}
+	}
+
+	reader := source.NewJSONL(input, mapping)
+	malformed := 0
+	if cfg.skipMalformed {
+		reader.OnMalformed = func(err *source.LineError) {
+			malformed++
+			fmt.Fprintf(stderr, "upsert: skipping %v\n", err)
+		}
+	}
+
+	mapUpserter := upsert.NewMapUpserter(upserter)
+	if cfg.keepMissing {
+		mapUpserter = mapUpserter.WithMissingUnchanged()
+	}
+
+	defer func() {
+		if malformed > 0 {
+			fmt.Fprintf(stderr, "upsert: skipped %d malformed lines\n", malformed)
+		}
+	}()
+	for {
+		rows, err := reader.ReadMaps(cfg.chunkSize)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := mapUpserter.Upsert(ctx, cfg.table, rows, cfg.keys); err != nil {
+			return err
+		}
+	}
+}
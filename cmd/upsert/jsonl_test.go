@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type recordedUpsert struct {
+	columns []string
+	rows    [][]any
+}
+
+type recordingUpserter struct {
+	calls []recordedUpsert
+}
+
+func (r *recordingUpserter) Upsert(_ context.Context, _ string, columns []string, rows [][]any, _ []string) error {
+	r.calls = append(r.calls, recordedUpsert{columns: columns, rows: rows})
+	return nil
+}
+
+func TestLoadJSONL_SkipMalformed(t *testing.T) {
+	input := "{\"id\": 1, \"name\": \"John\"}\nnot json\n{\"id\": 2}\n"
+	cfg := config{table: "users", keys: []string{"id"}, chunkSize: 10, keepMissing: true, skipMalformed: true}
+
+	var stderr strings.Builder
+	recorder := &recordingUpserter{}
+	if err := loadJSONL(context.Background(), recorder, cfg, strings.NewReader(input), &stderr); err != nil {
+		t.Fatalf("loadJSONL: %v", err)
+	}
+
+	want := []recordedUpsert{
+		{columns: []string{"id", "name"}, rows: [][]any{{json.Number("1"), "John"}}},
+		{columns: []string{"id"}, rows: [][]any{{json.Number("2")}}},
+	}
+	if !reflect.DeepEqual(recorder.calls, want) {
+		t.Fatalf("upserts = %v, want %v", recorder.calls, want)
+	}
+	if !strings.Contains(stderr.String(), "line 2") {
+		t.Fatalf("expected malformed line report, got %q", stderr.String())
+	}
+}
+
+func TestLoadJSONL_StopsOnMalformed(t *testing.T) {
+	cfg := config{table: "users", keys: []string{"id"}, chunkSize: 10}
+
+	err := loadJSONL(context.Background(), &recordingUpserter{}, cfg, strings.NewReader("{\"id\": 1}\n{oops\n"), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected error mentioning line 2, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	cfg, err := parseFlags([]string{"--table", "users", "--keys", "id, email", "--strategy", "hash", "users.csv"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.table != "users" || cfg.strategy != "hash" || cfg.path != "users.csv" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if want := []string{"id", "email"}; !reflect.DeepEqual(cfg.keys, want) {
+		t.Fatalf("keys = %v, want %v", cfg.keys, want)
+	}
+	if cfg.coerce || cfg.validate {
+		t.Fatalf("coerce = %v, validate = %v; want neither by default", cfg.coerce, cfg.validate)
+	}
+}
+
+func TestParseFlags_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "missingTable", args: []string{"--keys", "id", "users.csv"}},
+		{name: "missingKeys", args: []string{"--table", "users", "users.csv"}},
+		{name: "missingFile", args: []string{"--table", "users", "--keys", "id"}},
+		{name: "badChunkSize", args: []string{"--table", "users", "--keys", "id", "--chunk-size", "0", "users.csv"}},
+		{name: "mappingForCSV", args: []string{"--table", "users", "--keys", "id", "--mapping", "m.json", "users.csv"}},
+		{name: "parquetFromStdin", args: []string{"--table", "users", "--keys", "id", "--format", "parquet", "-"}},
+		{name: "explainWithoutDryRun", args: []string{"--table", "users", "--keys", "id", "--explain", "users.csv"}},
+		{name: "unknownFormat", args: []string{"--table", "users", "--keys", "id", "--format", "xml", "users.xml"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseFlags(tc.args, io.Discard); err == nil {
+				t.Fatalf("parseFlags(%v) expected error, got nil", tc.args)
+			}
+		})
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := map[string]string{
+		"users.csv":           "csv",
+		"events.jsonl":        "jsonl",
+		"events.NDJSON":       "jsonl",
+		"-":                   "csv",
+		"lake/part-0.parquet": "parquet",
+		"dir.jsonl/data.txt":  "csv",
+	}
+	for path, want := range tests {
+		if got := formatFromPath(path); got != want {
+			t.Fatalf("formatFromPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
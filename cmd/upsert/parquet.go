@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/cantart/upsert-benchmark/source"
+	"github.com/cantart/upsert-benchmark/upsert"
+)
+
+func loadParquet(ctx context.Context, upserter upsert.Upserter, cfg config, input *os.File) error {
+	info, err := input.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader, err := source.NewParquet(input, info.Size())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return loadRows(ctx, upserter, cfg, reader, nil)
+}
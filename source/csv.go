@@ -0,0 +1,72 @@
+package source
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CSV reads rows from CSV input whose first record names the columns. Values are
+// returned as strings.
+type CSV struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func NewCSV(r io.Reader) (*CSV, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv: missing header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("csv: read header: %w", err)
+	}
+
+	columns := make([]string, len(header))
+	seen := make(map[string]struct{}, len(header))
+	for i, name := range header {
+		if name == "" {
+			return nil, fmt.Errorf("csv: header column %d is empty", i)
+		}
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("csv: duplicate header column %q", name)
+		}
+		seen[name] = struct{}{}
+		columns[i] = name
+	}
+	return &CSV{reader: reader, columns: columns}, nil
+}
+
+func (c *CSV) Columns() []string {
+	return c.columns
+}
+
+func (c *CSV) Read(max int) ([][]any, error) {
+	if max <= 0 {
+		return nil, errors.New("csv: max rows must be positive")
+	}
+
+	var rows [][]any
+	for len(rows) < max {
+		record, err := c.reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return rows, fmt.Errorf("csv: %w", err)
+		}
+		row := make([]any, len(record))
+		for i, value := range record {
+			row[i] = value
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, io.EOF
+	}
+	return rows, nil
+}
@@ -0,0 +1,71 @@
+package source
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVRead_Chunks(t *testing.T) {
+	input := "id,name\n1,John\n2,Jane\n3,\n"
+	reader, err := NewCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("NewCSV: %v", err)
+	}
+
+	if got, want := reader.Columns(), []string{"id", "name"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Columns() = %v, want %v", got, want)
+	}
+
+	first, err := reader.Read(2)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if want := [][]any{{"1", "John"}, {"2", "Jane"}}; !reflect.DeepEqual(first, want) {
+		t.Fatalf("first chunk = %v, want %v", first, want)
+	}
+
+	second, err := reader.Read(2)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if want := [][]any{{"3", ""}}; !reflect.DeepEqual(second, want) {
+		t.Fatalf("second chunk = %v, want %v", second, want)
+	}
+
+	if _, err := reader.Read(2); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestCSVRead_FieldCountMismatch(t *testing.T) {
+	reader, err := NewCSV(strings.NewReader("id,name\n1,John\n2\n"))
+	if err != nil {
+		t.Fatalf("NewCSV: %v", err)
+	}
+
+	if _, err := reader.Read(10); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("expected error mentioning line 3, got %v", err)
+	}
+}
+
+func TestNewCSV_InvalidHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "duplicate", input: "id,id\n"},
+		{name: "blank", input: "id,\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewCSV(strings.NewReader(tc.input)); err == nil {
+				t.Fatalf("NewCSV(%q) expected error, got nil", tc.input)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// LineError reports a malformed input line.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// JSONL reads JSON Lines (NDJSON) input where every non-blank line is one object.
+//
+// Without a mapping, top-level fields become columns of the same name. With a mapping,
+// only the mapped fields are read; mapping keys may be dotted paths into nested objects.
+// Nested objects and arrays are encoded back to JSON text so they can be stored in
+// jsonb columns, and numbers are kept as json.Number to preserve precision.
+type JSONL struct {
+	reader  *bufio.Reader
+	mapping map[string]string
+	line    int
+
+	// OnMalformed, when set, is called for every malformed line, which is then skipped.
+	// When nil, ReadMaps stops at the first malformed line and returns a *LineError.
+	OnMalformed func(err *LineError)
+}
+
+func NewJSONL(r io.Reader, mapping map[string]string) *JSONL {
+	return &JSONL{reader: bufio.NewReader(r), mapping: mapping}
+}
+
+// LoadMapping reads a field-to-column mapping from a JSON object file such as
+// {"id": "user_id", "profile.email": "email"}.
+func LoadMapping(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("mapping: %w", err)
+	}
+	var mapping map[string]string
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", path, err)
+	}
+	seen := make(map[string]string, len(mapping))
+	for field, column := range mapping {
+		if field == "" || column == "" {
+			return nil, fmt.Errorf("mapping %s: empty field or column name", path)
+		}
+		if other, dup := seen[column]; dup {
+			return nil, fmt.Errorf("mapping %s: fields %q and %q both map to column %q", path, other, field, column)
+		}
+		seen[column] = field
+	}
+	return mapping, nil
+}
+
+// ReadMaps returns up to max rows keyed by column. It returns io.EOF once no rows remain.
+func (j *JSONL) ReadMaps(max int) ([]map[string]any, error) {
+	if max <= 0 {
+		return nil, errors.New("jsonl: max rows must be positive")
+	}
+
+	var rows []map[string]any
+	for len(rows) < max {
+		line, err := j.reader.ReadBytes('\n')
+		if len(line) == 0 && errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return rows, fmt.Errorf("jsonl: %w", err)
+		}
+		j.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		row, parseErr := j.parseLine(line)
+		if parseErr != nil {
+			lineErr := &LineError{Line: j.line, Err: parseErr}
+			if j.OnMalformed == nil {
+				return rows, lineErr
+			}
+			j.OnMalformed(lineErr)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, io.EOF
+	}
+	return rows, nil
+}
+
+func (j *JSONL) parseLine(line []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+
+	var object map[string]any
+	if err := dec.Decode(&object); err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, errors.New("expected a JSON object")
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+
+	if j.mapping == nil {
+		row := make(map[string]any, len(object))
+		for field, value := range object {
+			encoded, err := columnValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", field, err)
+			}
+			row[field] = encoded
+		}
+		return row, nil
+	}
+
+	row := make(map[string]any, len(j.mapping))
+	for field, column := range j.mapping {
+		value, ok := lookupPath(object, field)
+		if !ok {
+			continue
+		}
+		encoded, err := columnValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", field, err)
+		}
+		row[column] = encoded
+	}
+	return row, nil
+}
+
+// lookupPath resolves a dotted path; an exact top-level match wins over nesting.
+func lookupPath(object map[string]any, path string) (any, bool) {
+	if value, ok := object[path]; ok {
+		return value, true
+	}
+	head, rest, found := strings.Cut(path, ".")
+	if !found {
+		return nil, false
+	}
+	nested, ok := object[head].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	return lookupPath(nested, rest)
+}
+
+// columnValue converts a decoded JSON value into a driver-friendly value.
+func columnValue(value any) (any, error) {
+	switch value.(type) {
+	case map[string]any, []any:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(encoded), nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,104 @@
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONLReadMaps(t *testing.T) {
+	input := `{"id": 1, "name": "John", "tags": ["a", "b"]}
+
+{"id": 2, "profile": {"email": "jane@example.com"}, "active": true}
+`
+	reader := NewJSONL(strings.NewReader(input), nil)
+
+	rows, err := reader.ReadMaps(10)
+	if err != nil {
+		t.Fatalf("ReadMaps: %v", err)
+	}
+	want := []map[string]any{
+		{"id": json.Number("1"), "name": "John", "tags": `["a","b"]`},
+		{"id": json.Number("2"), "profile": `{"email":"jane@example.com"}`, "active": true},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("ReadMaps() = %v, want %v", rows, want)
+	}
+
+	if _, err := reader.ReadMaps(10); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestJSONLReadMaps_Mapping(t *testing.T) {
+	input := `{"id": 1, "profile": {"email": "john@example.com"}, "ignored": "x"}` + "\n" + `{"id": 2}`
+	reader := NewJSONL(strings.NewReader(input), map[string]string{"id": "user_id", "profile.email": "email"})
+
+	rows, err := reader.ReadMaps(10)
+	if err != nil {
+		t.Fatalf("ReadMaps: %v", err)
+	}
+	want := []map[string]any{
+		{"user_id": json.Number("1"), "email": "john@example.com"},
+		{"user_id": json.Number("2")},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("ReadMaps() = %v, want %v", rows, want)
+	}
+}
+
+func TestJSONLReadMaps_Malformed(t *testing.T) {
+	input := "{\"id\": 1}\n{\"id\": \n[1, 2]\n{\"id\": 4}\n"
+
+	strict := NewJSONL(strings.NewReader(input), nil)
+	_, err := strict.ReadMaps(10)
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 2 {
+		t.Fatalf("expected LineError on line 2, got %v", err)
+	}
+
+	lenient := NewJSONL(strings.NewReader(input), nil)
+	var malformed []int
+	lenient.OnMalformed = func(err *LineError) {
+		malformed = append(malformed, err.Line)
+	}
+	rows, err := lenient.ReadMaps(10)
+	if err != nil {
+		t.Fatalf("ReadMaps: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if want := []int{2, 3}; !reflect.DeepEqual(malformed, want) {
+		t.Fatalf("malformed lines = %v, want %v", malformed, want)
+	}
+}
+
+func TestLoadMapping(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	if err := os.WriteFile(valid, []byte(`{"id": "user_id", "profile.email": "email"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	mapping, err := LoadMapping(valid)
+	if err != nil {
+		t.Fatalf("LoadMapping: %v", err)
+	}
+	if want := map[string]string{"id": "user_id", "profile.email": "email"}; !reflect.DeepEqual(mapping, want) {
+		t.Fatalf("LoadMapping() = %v, want %v", mapping, want)
+	}
+
+	duplicate := filepath.Join(dir, "duplicate.json")
+	if err := os.WriteFile(duplicate, []byte(`{"a": "col", "b": "col"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := LoadMapping(duplicate); err == nil {
+		t.Fatal("expected error for duplicate column mapping, got nil")
+	}
+}
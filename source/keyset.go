@@ -0,0 +1,194 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cantart/upsert-benchmark/upsert"
+)
+
+// Keyset pages through a table or query in key order. Each page continues after the
+// last key seen (WHERE (keys) > (last) ORDER BY keys LIMIT n), so reads stay cheap
+// however deep into the source they are and can resume from a saved key.
+type Keyset struct {
+	db         *sql.DB
+	from       string
+	selectList string
+	orderBy    string
+	keyTuple   string
+
+	columns []string
+	keyIdx  []int
+	binary  []bool
+	lastKey []any
+}
+
+// NewTableKeyset reads columns (all columns when empty) of table ordered by keys.
+func NewTableKeyset(ctx context.Context, db *sql.DB, table string, columns, keys []string) (*Keyset, error) {
+	ref, err := upsert.ParseTableRef(table)
+	if err != nil {
+		return nil, fmt.Errorf("keyset: %w", err)
+	}
+	from, err := ref.Quote(upsert.Postgres)
+	if err != nil {
+		return nil, fmt.Errorf("keyset: table %q: %w", table, err)
+	}
+	return newKeyset(ctx, db, from, columns, keys)
+}
+
+// NewQueryKeyset reads the rows of an arbitrary SELECT ordered by keys, which must be
+// columns of its result.
+func NewQueryKeyset(ctx context.Context, db *sql.DB, query string, keys []string) (*Keyset, error) {
+	query = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+	if query == "" {
+		return nil, errors.New("keyset: query is empty")
+	}
+	return newKeyset(ctx, db, fmt.Sprintf("(%s) AS src", query), nil, keys)
+}
+
+func newKeyset(ctx context.Context, db *sql.DB, from string, columns, keys []string) (*Keyset, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyset: at least one key column is required")
+	}
+
+	selectList := "*"
+	if len(columns) > 0 {
+		quoted := make([]string, len(columns))
+		for i, col := range columns {
+			q, err := upsert.Postgres.QuoteIdentifier(col)
+			if err != nil {
+				return nil, fmt.Errorf("keyset: column %q: %w", col, err)
+			}
+			quoted[i] = q
+		}
+		selectList = strings.Join(quoted, ", ")
+	}
+
+	probe, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s LIMIT 0", selectList, from))
+	if err != nil {
+		return nil, fmt.Errorf("keyset: describe source: %w", err)
+	}
+	types, err := probe.ColumnTypes()
+	probe.Close()
+	if err != nil {
+		return nil, fmt.Errorf("keyset: describe source: %w", err)
+	}
+
+	k := &Keyset{db: db, from: from, selectList: selectList}
+	index := make(map[string]int, len(types))
+	for i, typ := range types {
+		k.columns = append(k.columns, typ.Name())
+		k.binary = append(k.binary, typ.DatabaseTypeName() == "BYTEA")
+		index[typ.Name()] = i
+	}
+
+	quotedKeys := make([]string, len(keys))
+	for i, key := range keys {
+		idx, ok := index[key]
+		if !ok {
+			return nil, fmt.Errorf("keyset: key %q is not a source column", key)
+		}
+		k.keyIdx = append(k.keyIdx, idx)
+		q, err := upsert.Postgres.QuoteIdentifier(key)
+		if err != nil {
+			return nil, fmt.Errorf("keyset: key %q: %w", key, err)
+		}
+		quotedKeys[i] = q
+	}
+	k.orderBy = strings.Join(quotedKeys, ", ")
+	k.keyTuple = k.orderBy
+	if len(keys) > 1 {
+		k.keyTuple = "(" + k.keyTuple + ")"
+	}
+	return k, nil
+}
+
+func (k *Keyset) Columns() []string {
+	return k.columns
+}
+
+// LastKey returns the key values of the last row read, or nil before the first page.
+func (k *Keyset) LastKey() []any {
+	return k.lastKey
+}
+
+// Resume makes the next read start after key.
+func (k *Keyset) Resume(key []any) error {
+	if len(key) != len(k.keyIdx) {
+		return fmt.Errorf("keyset: resume key has %d values, want %d", len(key), len(k.keyIdx))
+	}
+	k.lastKey = key
+	return nil
+}
+
+func (k *Keyset) Read(max int) ([][]any, error) {
+	return k.ReadContext(context.Background(), max)
+}
+
+// ReadContext returns the next page of at most max rows. It returns io.EOF once no rows remain.
+func (k *Keyset) ReadContext(ctx context.Context, max int) ([][]any, error) {
+	if max <= 0 {
+		return nil, errors.New("keyset: max rows must be positive")
+	}
+
+	query, args := k.pageQuery(max)
+	result, err := k.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("keyset: %w", err)
+	}
+	defer result.Close()
+
+	var rows [][]any
+	for result.Next() {
+		row := make([]any, len(k.columns))
+		dest := make([]any, len(row))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := result.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("keyset: %w", err)
+		}
+		for i, value := range row {
+			// Drivers return many text-format values as []byte; pass them back as
+			// text so they are not re-encoded as bytea.
+			if b, ok := value.([]byte); ok && !k.binary[i] {
+				row[i] = string(b)
+			}
+		}
+		rows = append(rows, row)
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("keyset: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, io.EOF
+	}
+
+	last := rows[len(rows)-1]
+	k.lastKey = make([]any, len(k.keyIdx))
+	for i, idx := range k.keyIdx {
+		k.lastKey[i] = last[idx]
+	}
+	return rows, nil
+}
+
+func (k *Keyset) pageQuery(limit int) (string, []any) {
+	if k.lastKey == nil {
+		return fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT %d", k.selectList, k.from, k.orderBy, limit), nil
+	}
+
+	placeholders := make([]string, len(k.lastKey))
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	after := strings.Join(placeholders, ", ")
+	if len(placeholders) > 1 {
+		after = "(" + after + ")"
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s > %s ORDER BY %s LIMIT %d", k.selectList, k.from, k.keyTuple, after, k.orderBy, limit)
+	return query, k.lastKey
+}
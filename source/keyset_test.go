@@ -0,0 +1,160 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestKeysetReadContext_Pages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	columns := []*sqlmock.Column{
+		sqlmock.NewColumn("id").OfType("INT8", int64(0)),
+		sqlmock.NewColumn("name").OfType("NUMERIC", []byte(nil)),
+		sqlmock.NewColumn("avatar").OfType("BYTEA", []byte(nil)),
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "analytics"."users" LIMIT 0`)).
+		WillReturnRows(sqlmock.NewRowsWithColumnDefinition(columns...))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "analytics"."users" ORDER BY "id" LIMIT 2`)).
+		WillReturnRows(sqlmock.NewRowsWithColumnDefinition(columns...).
+			AddRow(int64(1), []byte("1.50"), []byte{0x01}).
+			AddRow(int64(2), []byte("2.00"), nil))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "analytics"."users" WHERE "id" > $1 ORDER BY "id" LIMIT 2`)).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRowsWithColumnDefinition(columns...))
+
+	ctx := context.Background()
+	reader, err := NewTableKeyset(ctx, db, "analytics.users", nil, []string{"id"})
+	if err != nil {
+		t.Fatalf("NewTableKeyset: %v", err)
+	}
+	if want := []string{"id", "name", "avatar"}; !reflect.DeepEqual(reader.Columns(), want) {
+		t.Fatalf("Columns() = %v, want %v", reader.Columns(), want)
+	}
+
+	rows, err := reader.ReadContext(ctx, 2)
+	if err != nil {
+		t.Fatalf("ReadContext: %v", err)
+	}
+	want := [][]any{{int64(1), "1.50", []byte{0x01}}, {int64(2), "2.00", nil}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %#v, want %#v", rows, want)
+	}
+	if !reflect.DeepEqual(reader.LastKey(), []any{int64(2)}) {
+		t.Fatalf("LastKey() = %v, want [2]", reader.LastKey())
+	}
+
+	if _, err := reader.ReadContext(ctx, 2); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestKeysetReadContext_ResumeCompositeKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM (SELECT tenant, id, name FROM users) AS src LIMIT 0`)).
+		WillReturnRows(sqlmock.NewRows([]string{"tenant", "id", "name"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM (SELECT tenant, id, name FROM users) AS src WHERE ("tenant", "id") > ($1, $2) ORDER BY "tenant", "id" LIMIT 10`)).
+		WithArgs("acme", int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"tenant", "id", "name"}).AddRow("acme", int64(10), "John"))
+
+	ctx := context.Background()
+	reader, err := NewQueryKeyset(ctx, db, "SELECT tenant, id, name FROM users;", []string{"tenant", "id"})
+	if err != nil {
+		t.Fatalf("NewQueryKeyset: %v", err)
+	}
+	if err := reader.Resume([]any{"acme"}); err == nil {
+		t.Fatal("expected error for short resume key, got nil")
+	}
+	if err := reader.Resume([]any{"acme", int64(9)}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+
+	rows, err := reader.ReadContext(ctx, 10)
+	if err != nil {
+		t.Fatalf("ReadContext: %v", err)
+	}
+	if len(rows) != 1 || !reflect.DeepEqual(reader.LastKey(), []any{"acme", int64(10)}) {
+		t.Fatalf("rows = %v, last key = %v", rows, reader.LastKey())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestNewTableKeyset_UnknownKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "users" LIMIT 0`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if _, err := NewTableKeyset(context.Background(), db, "users", []string{"id"}, []string{"email"}); err == nil {
+		t.Fatal("expected error for key outside selected columns, got nil")
+	}
+}
+
+func TestNewTableKeyset_QuotedTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "Sales"."order.items" LIMIT 0`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if _, err := NewTableKeyset(context.Background(), db, `"Sales"."order.items"`, []string{"id"}, []string{"id"}); err != nil {
+		t.Fatalf("NewTableKeyset: %v", err)
+	}
+	if _, err := NewTableKeyset(context.Background(), db, "analytics..users", nil, []string{"id"}); err == nil {
+		t.Fatal("expected error for empty table name part, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestNewTableKeyset_LongIdentifier(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	long := strings.Repeat("a", 64)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM (SELECT 1) AS src LIMIT 0`)).
+		WillReturnRows(sqlmock.NewRows([]string{long}))
+
+	if _, err := NewTableKeyset(context.Background(), db, "users", []string{long}, []string{"id"}); err == nil {
+		t.Fatal("expected error for column name over 63 bytes, got nil")
+	}
+	if _, err := NewQueryKeyset(context.Background(), db, "SELECT 1", []string{long}); err == nil {
+		t.Fatal("expected error for key name over 63 bytes, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
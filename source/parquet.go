@@ -0,0 +1,392 @@
+package source
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// Parquet reads rows from a Parquet file one row group at a time, holding at most
+// the requested number of rows in memory.
+//
+// Top-level fields become columns. Logical types are mapped to values lib/pq accepts:
+// timestamps and dates to time.Time, decimals to exact decimal strings, UUIDs to their
+// canonical text, and lists of scalars to pq.GenericArray. Other nested groups
+// (structs, maps, lists of groups) are encoded as JSON text for jsonb columns.
+type Parquet struct {
+	file    *parquet.File
+	columns []string
+	fields  []parquetField
+
+	group int
+	rows  parquet.Rows
+	buf   []parquet.Row
+
+	reconstruct bool
+}
+
+type parquetFieldKind int
+
+const (
+	parquetScalar parquetFieldKind = iota
+	parquetList
+	parquetJSON
+)
+
+// parquetField describes how one top-level field maps onto leaf columns.
+type parquetField struct {
+	name string
+	kind parquetFieldKind
+	leaf parquet.LeafColumn
+	// fieldDef and elemDef are the definition levels at which a list is present
+	// and at which it holds at least one element.
+	fieldDef int
+	elemDef  int
+}
+
+func NewParquet(r io.ReaderAt, size int64) (*Parquet, error) {
+	file, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: %w", err)
+	}
+
+	p := &Parquet{file: file}
+	schema := file.Schema()
+	for _, node := range schema.Fields() {
+		field, err := describeParquetField(schema, node)
+		if err != nil {
+			return nil, err
+		}
+		if field.kind == parquetJSON {
+			p.reconstruct = true
+		}
+		p.columns = append(p.columns, field.name)
+		p.fields = append(p.fields, field)
+	}
+	if len(p.fields) == 0 {
+		return nil, errors.New("parquet: schema has no fields")
+	}
+	return p, nil
+}
+
+func describeParquetField(schema *parquet.Schema, node parquet.Field) (parquetField, error) {
+	field := parquetField{name: node.Name(), kind: parquetJSON}
+	if node.Optional() || node.Repeated() {
+		field.fieldDef = 1
+	}
+
+	switch {
+	case node.Leaf() && node.Repeated():
+		// A bare repeated primitive is a list without the LIST wrapper.
+		field.kind = parquetList
+		field.fieldDef = 0
+		field.elemDef = 1
+		field.leaf, _ = schema.Lookup(node.Name())
+	case node.Leaf():
+		field.kind = parquetScalar
+		field.leaf, _ = schema.Lookup(node.Name())
+	case isListType(node) && len(node.Fields()) == 1:
+		repeated := node.Fields()[0]
+		path := []string{node.Name(), repeated.Name()}
+		if !repeated.Leaf() {
+			if len(repeated.Fields()) != 1 || !repeated.Fields()[0].Leaf() {
+				break
+			}
+			path = append(path, repeated.Fields()[0].Name())
+		}
+		leaf, ok := schema.Lookup(path...)
+		if !ok {
+			return field, fmt.Errorf("parquet: field %q: list element column not found", node.Name())
+		}
+		field.kind = parquetList
+		field.leaf = leaf
+		field.elemDef = field.fieldDef + 1
+	}
+	return field, nil
+}
+
+func isListType(node parquet.Node) bool {
+	lt := node.Type().LogicalType()
+	return lt != nil && lt.List != nil
+}
+
+func (p *Parquet) Columns() []string {
+	return p.columns
+}
+
+// NumRows returns the total number of rows in the file.
+func (p *Parquet) NumRows() int64 {
+	return p.file.NumRows()
+}
+
+func (p *Parquet) Read(max int) ([][]any, error) {
+	if max <= 0 {
+		return nil, errors.New("parquet: max rows must be positive")
+	}
+	if cap(p.buf) < max {
+		p.buf = make([]parquet.Row, max)
+	}
+
+	var out [][]any
+	for len(out) < max {
+		if p.rows == nil {
+			groups := p.file.RowGroups()
+			if p.group >= len(groups) {
+				break
+			}
+			p.rows = groups[p.group].Rows()
+			p.group++
+		}
+
+		n, err := p.rows.ReadRows(p.buf[:max-len(out)])
+		for _, row := range p.buf[:n] {
+			converted, convErr := p.convertRow(row)
+			if convErr != nil {
+				return out, fmt.Errorf("parquet: row group %d: %w", p.group-1, convErr)
+			}
+			out = append(out, converted)
+		}
+		if errors.Is(err, io.EOF) {
+			if closeErr := p.rows.Close(); closeErr != nil {
+				return out, fmt.Errorf("parquet: %w", closeErr)
+			}
+			p.rows = nil
+			continue
+		}
+		if err != nil {
+			return out, fmt.Errorf("parquet: %w", err)
+		}
+	}
+	if len(out) == 0 {
+		return nil, io.EOF
+	}
+	return out, nil
+}
+
+// Close releases the row group currently being read.
+func (p *Parquet) Close() error {
+	if p.rows == nil {
+		return nil
+	}
+	err := p.rows.Close()
+	p.rows = nil
+	return err
+}
+
+func (p *Parquet) convertRow(row parquet.Row) ([]any, error) {
+	columns := make([][]parquet.Value, len(p.file.Schema().Columns()))
+	row.Range(func(columnIndex int, values []parquet.Value) bool {
+		columns[columnIndex] = values
+		return true
+	})
+
+	var nested map[string]any
+	if p.reconstruct {
+		nested = make(map[string]any)
+		if err := p.file.Schema().Reconstruct(&nested, row); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]any, len(p.fields))
+	for i, field := range p.fields {
+		var err error
+		switch field.kind {
+		case parquetScalar:
+			out[i], err = parquetValue(columns[field.leaf.ColumnIndex][0], field.leaf.Node.Type())
+		case parquetList:
+			out[i], err = parquetListValue(columns[field.leaf.ColumnIndex], field)
+		case parquetJSON:
+			value, ok := nested[field.name]
+			if !ok || value == nil {
+				continue
+			}
+			var encoded []byte
+			if encoded, err = json.Marshal(value); err == nil {
+				out[i] = string(encoded)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", field.name, err)
+		}
+	}
+	return out, nil
+}
+
+func parquetListValue(values []parquet.Value, field parquetField) (any, error) {
+	elements := make([]any, 0, len(values))
+	for _, v := range values {
+		def := v.DefinitionLevel()
+		switch {
+		case def < field.fieldDef:
+			return nil, nil
+		case def < field.elemDef:
+			// The list is present but empty.
+		case def < field.leaf.MaxDefinitionLevel:
+			elements = append(elements, nil)
+		default:
+			element, err := parquetValue(v, field.leaf.Node.Type())
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+	}
+	return pq.GenericArray{A: elements}, nil
+}
+
+// parquetValue converts a leaf value according to its logical and physical type.
+func parquetValue(v parquet.Value, typ parquet.Type) (any, error) {
+	if v.IsNull() {
+		return nil, nil
+	}
+
+	if lt := typ.LogicalType(); lt != nil {
+		switch {
+		case lt.UTF8 != nil, lt.Enum != nil, lt.Json != nil:
+			return string(v.ByteArray()), nil
+		case lt.UUID != nil:
+			return formatUUID(v.ByteArray())
+		case lt.Date != nil:
+			return time.Unix(int64(v.Int32())*86400, 0).UTC(), nil
+		case lt.Timestamp != nil:
+			return timestampValue(v.Int64(), lt.Timestamp.Unit), nil
+		case lt.Time != nil:
+			var d time.Duration
+			if v.Kind() == parquet.Int32 {
+				d = time.Duration(v.Int32()) * unitDuration(lt.Time.Unit)
+			} else {
+				d = time.Duration(v.Int64()) * unitDuration(lt.Time.Unit)
+			}
+			return time.Time{}.Add(d).Format("15:04:05.999999999"), nil
+		case lt.Decimal != nil:
+			return decimalValue(v, int(lt.Decimal.Scale))
+		case lt.Integer != nil:
+			if t := lt.Integer; !t.IsSigned {
+				switch t.BitWidth {
+				case 64:
+					if u := uint64(v.Int64()); u > math.MaxInt64 {
+						return strconv.FormatUint(u, 10), nil
+					}
+				case 32:
+					return int64(uint32(v.Int32())), nil
+				}
+			}
+		}
+	}
+
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean(), nil
+	case parquet.Int32:
+		return int64(v.Int32()), nil
+	case parquet.Int64:
+		return v.Int64(), nil
+	case parquet.Int96:
+		return int96Time(v.Int96()), nil
+	case parquet.Float:
+		return float64(v.Float()), nil
+	case parquet.Double:
+		return v.Double(), nil
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return append([]byte(nil), v.ByteArray()...), nil
+	default:
+		return nil, fmt.Errorf("unsupported parquet kind %s", v.Kind())
+	}
+}
+
+func timestampValue(n int64, unit format.TimeUnit) time.Time {
+	switch {
+	case unit.Millis != nil:
+		return time.UnixMilli(n).UTC()
+	case unit.Micros != nil:
+		return time.UnixMicro(n).UTC()
+	default:
+		return time.Unix(0, n).UTC()
+	}
+}
+
+// unitDuration returns the length of one tick of unit.
+func unitDuration(unit format.TimeUnit) time.Duration {
+	switch {
+	case unit.Millis != nil:
+		return time.Millisecond
+	case unit.Micros != nil:
+		return time.Microsecond
+	default:
+		return time.Nanosecond
+	}
+}
+
+// int96Time decodes the legacy Impala timestamp: nanoseconds of day followed by a Julian day.
+func int96Time(v deprecated.Int96) time.Time {
+	const unixEpochJulianDay = 2440588
+	nanos := int64(v[1])<<32 | int64(v[0])
+	days := int64(v[2]) - unixEpochJulianDay
+	return time.Unix(days*86400, nanos).UTC()
+}
+
+func decimalValue(v parquet.Value, scale int) (string, error) {
+	var unscaled *big.Int
+	switch v.Kind() {
+	case parquet.Int32:
+		unscaled = big.NewInt(int64(v.Int32()))
+	case parquet.Int64:
+		unscaled = big.NewInt(v.Int64())
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		b := v.ByteArray()
+		unscaled = new(big.Int).SetBytes(b)
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+		}
+	default:
+		return "", fmt.Errorf("unsupported decimal kind %s", v.Kind())
+	}
+	return formatDecimal(unscaled, scale), nil
+}
+
+// formatDecimal renders unscaled × 10^-scale without losing precision.
+func formatDecimal(unscaled *big.Int, scale int) string {
+	digits := new(big.Int).Abs(unscaled).String()
+	sign := ""
+	if unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if scale <= 0 {
+		return sign + digits + strings.Repeat("0", -scale)
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	point := len(digits) - scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func formatUUID(b []byte) (string, error) {
+	if len(b) != 16 {
+		return "", fmt.Errorf("uuid must be 16 bytes, got %d", len(b))
+	}
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:]), nil
+}
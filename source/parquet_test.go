@@ -0,0 +1,152 @@
+package source
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/parquet-go/parquet-go"
+)
+
+type parquetAddress struct {
+	City string `parquet:"city"`
+}
+
+type parquetRecord struct {
+	ID      int64          `parquet:"id"`
+	Name    *string        `parquet:"name,optional"`
+	Created time.Time      `parquet:"created,timestamp(microsecond)"`
+	Day     int32          `parquet:"day,date"`
+	Amount  int64          `parquet:"amount,decimal(2:18)"`
+	Tags    []string       `parquet:"tags,list"`
+	Scores  []int32        `parquet:"scores"`
+	Address parquetAddress `parquet:"address"`
+	Ref     [16]byte       `parquet:"ref"`
+}
+
+func TestParquetRead(t *testing.T) {
+	name := "John"
+	created := time.Date(2024, 5, 6, 7, 8, 9, 123000, time.UTC)
+	day := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	days := int32(day.Unix() / 86400)
+	ref := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+
+	var buf bytes.Buffer
+	writer := parquet.NewGenericWriter[parquetRecord](&buf, parquet.MaxRowsPerRowGroup(2))
+	records := []parquetRecord{
+		{ID: 1, Name: &name, Created: created, Day: days, Amount: -12345, Tags: []string{"a", "b"}, Scores: []int32{7}, Address: parquetAddress{City: "Oslo"}, Ref: ref},
+		{ID: 2, Created: created, Day: days, Amount: 5},
+		{ID: 3, Created: created, Day: days, Amount: 100},
+	}
+	if _, err := writer.Write(records); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reader, err := NewParquet(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewParquet: %v", err)
+	}
+	defer reader.Close()
+
+	wantColumns := []string{"id", "name", "created", "day", "amount", "tags", "scores", "address", "ref"}
+	if got := reader.Columns(); !reflect.DeepEqual(got, wantColumns) {
+		t.Fatalf("Columns() = %v, want %v", got, wantColumns)
+	}
+	if reader.NumRows() != 3 {
+		t.Fatalf("NumRows() = %d, want 3", reader.NumRows())
+	}
+
+	first, err := reader.Read(2)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(first))
+	}
+
+	want := []any{
+		int64(1), "John", created, day, "-123.45",
+		pq.GenericArray{A: []any{"a", "b"}},
+		pq.GenericArray{A: []any{int64(7)}},
+		`{"city":"Oslo"}`,
+		ref[:],
+	}
+	if !reflect.DeepEqual(first[0], want) {
+		t.Fatalf("row 0 = %#v, want %#v", first[0], want)
+	}
+	if first[1][1] != nil {
+		t.Fatalf("row 1 name = %#v, want nil", first[1][1])
+	}
+	if first[1][4] != "0.05" {
+		t.Fatalf("row 1 amount = %#v, want 0.05", first[1][4])
+	}
+	if got := first[1][5]; !reflect.DeepEqual(got, pq.GenericArray{A: []any{}}) {
+		t.Fatalf("row 1 tags = %#v, want empty array", got)
+	}
+
+	second, err := reader.Read(2)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(second) != 1 || second[0][0] != int64(3) {
+		t.Fatalf("second chunk = %v, want row with id 3", second)
+	}
+
+	if _, err := reader.Read(2); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestParquetRead_UUID(t *testing.T) {
+	ref := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+
+	// Struct tags do not annotate [16]byte as a UUID when writing, so spell out the schema.
+	var buf bytes.Buffer
+	writer := parquet.NewWriter(&buf, parquet.NewSchema("uuids", parquet.Group{"ref": parquet.UUID()}))
+	if _, err := writer.WriteRows([]parquet.Row{{parquet.FixedLenByteArrayValue(ref[:]).Level(0, 0, 0)}}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reader, err := NewParquet(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewParquet: %v", err)
+	}
+	defer reader.Close()
+	rows, err := reader.Read(1)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if want := "12345678-9abc-def0-1234-56789abcdef0"; len(rows) != 1 || rows[0][0] != want {
+		t.Fatalf("rows = %v, want [[%s]]", rows, want)
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		unscaled int64
+		scale    int
+		want     string
+	}{
+		{unscaled: 12345, scale: 2, want: "123.45"},
+		{unscaled: -5, scale: 3, want: "-0.005"},
+		{unscaled: 7, scale: 0, want: "7"},
+		{unscaled: 7, scale: -2, want: "700"},
+	}
+
+	for _, tc := range tests {
+		if got := formatDecimal(big.NewInt(tc.unscaled), tc.scale); got != tc.want {
+			t.Fatalf("formatDecimal(%d, %d) = %q, want %q", tc.unscaled, tc.scale, got, tc.want)
+		}
+	}
+}
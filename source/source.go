@@ -0,0 +1,10 @@
+// Package source reads rows from files and databases in bounded chunks, ready to be
+// handed to the strategies in package upsert.
+package source
+
+// Reader yields rows with a fixed column layout.
+type Reader interface {
+	Columns() []string
+	// Read returns up to max rows. It returns io.EOF once no rows remain.
+	Read(max int) ([][]any, error)
+}
@@ -0,0 +1,342 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// AutoUpserter picks NaiveUpserter, HashIndexedUpserter or BatchedHashIndexedUpserter
+// for every call, after looking at the target table and the rows:
+//
+//   - Without a unique index over the keys, and without the table ownership needed to
+//     create one, ON CONFLICT is impossible and the naive strategy is used.
+//   - Inputs that fit one statement of at most autoMaxHashRows rows go to the hash
+//     strategy in a single round trip.
+//   - Anything larger is batched. The batch size aims at autoTargetBatchBytes of values
+//     per statement, and is halved when most sampled keys already exist, because
+//     updates hold row locks for the length of the statement.
+//
+// The existing share of keys is estimated from up to autoSampleKeys keys spread over
+// the rows of the first call for a table and keys; the table facts and the estimate are
+// then reused for the life of the AutoUpserter, so chunked loads inspect the table once.
+// The decision is logged at Info and recorded with WithDecision. Table inspection needs
+// PostgreSQL.
+type AutoUpserter struct {
+	db *sql.DB
+	options
+	opts []Option
+
+	mu    sync.Mutex
+	facts map[string]autoTableFacts
+}
+
+// autoTableFacts is what Decide learned about a table and its unique keys.
+type autoTableFacts struct {
+	estimatedTuples int64
+	canCreateIndex  bool
+	hasUniqueIndex  bool
+	sampledKeys     int
+	existingKeys    int
+}
+
+const (
+	// autoMaxHashRows is the largest input sent as one statement, the default batch size
+	// of BatchedHashIndexedUpserter.
+	autoMaxHashRows = 500
+	// autoTargetBatchBytes is the approximate size of the values of one batch.
+	autoTargetBatchBytes = 512 << 10
+	autoMinBatchSize     = 50
+	autoMaxBatchSize     = 5000
+	autoSampleKeys       = 100
+	// autoSampleMaxTuples is the largest estimated table without a usable index whose
+	// keys are still sampled; beyond it the lookup would scan too much.
+	autoSampleMaxTuples = 100_000
+	// autoUpdateHeavy is the sampled existing share above which batches are halved.
+	autoUpdateHeavy = 0.5
+)
+
+// NewAutoUpserter returns an AutoUpserter. opts are passed on to the chosen strategy.
+func NewAutoUpserter(db *sql.DB, opts ...Option) *AutoUpserter {
+	return &AutoUpserter{db: db, options: newOptions(opts), opts: opts, facts: make(map[string]autoTableFacts)}
+}
+
+// Decision explains the strategy AutoUpserter chose for one call.
+type Decision struct {
+	// Strategy is the registered name of the chosen strategy: "naive", "hash" or "batched".
+	Strategy string
+	// BatchSize is the rows per statement for "batched", and 0 otherwise.
+	BatchSize int
+	Rows      int
+	// RowBytes is the estimated size of the values of one row.
+	RowBytes int
+	// HasUniqueIndex reports whether a unique index covers exactly the unique keys.
+	HasUniqueIndex bool
+	// CanCreateIndex reports whether the current user owns the table.
+	CanCreateIndex bool
+	// EstimatedTuples is the planner's row estimate for the table, -1 if unknown.
+	EstimatedTuples int64
+	// SampledKeys is the number of keys looked up, in the first call for the table;
+	// ExistingKeys of them were found. Both are 0 if sampling was skipped.
+	SampledKeys  int
+	ExistingKeys int
+	// Reasons lists why the strategy and batch size were chosen.
+	Reasons []string
+}
+
+// ConflictRatio returns the share of sampled keys that already exist, or -1 if no keys
+// were sampled.
+func (d Decision) ConflictRatio() float64 {
+	if d.SampledKeys == 0 {
+		return -1
+	}
+	return float64(d.ExistingKeys) / float64(d.SampledKeys)
+}
+
+// String summarizes the decision on one line.
+func (d Decision) String() string {
+	strategy := d.Strategy
+	if d.BatchSize > 0 {
+		strategy = fmt.Sprintf("%s (batch size %d)", d.Strategy, d.BatchSize)
+	}
+	return fmt.Sprintf("%s: %s", strategy, strings.Join(d.Reasons, "; "))
+}
+
+type decisionKey struct{}
+
+// WithDecision returns a context in which AutoUpserter stores the decision of each call
+// in d.
+func WithDecision(ctx context.Context, d *Decision) context.Context {
+	return context.WithValue(ctx, decisionKey{}, d)
+}
+
+func (a *AutoUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	d, err := a.Decide(ctx, table, columns, rows, uniqueKeys)
+	if err != nil {
+		return err
+	}
+	if dest, ok := ctx.Value(decisionKey{}).(*Decision); ok && dest != nil {
+		*dest = d
+	}
+	a.log().LogAttrs(ctx, slog.LevelInfo, "upsert auto decision",
+		slog.String("table", table),
+		slog.String("strategy", d.Strategy),
+		slog.Int("batch_size", d.BatchSize),
+		slog.String("reasons", strings.Join(d.Reasons, "; ")),
+	)
+
+	opts := a.opts
+	if d.HasUniqueIndex {
+		// The index is there; creating ours would need ownership or add a duplicate.
+		opts = append(slices.Clip(opts), WithExistingUniqueIndex())
+	}
+	upserter, err := New(d.Strategy, StrategyConfig{DB: a.db, BatchSize: d.BatchSize, Options: opts})
+	if err != nil {
+		return err
+	}
+	if err := upserter.Upsert(ctx, table, columns, rows, uniqueKeys); err != nil {
+		return err
+	}
+	if d.Strategy != "naive" && !d.HasUniqueIndex {
+		// The strategy created the index, so later calls need not.
+		key := autoFactsKey(table, uniqueKeys)
+		a.mu.Lock()
+		if facts, ok := a.facts[key]; ok {
+			facts.hasUniqueIndex = true
+			a.facts[key] = facts
+		}
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// autoFactsKey identifies a table and its unique keys in AutoUpserter's cache.
+func autoFactsKey(table string, uniqueKeys []string) string {
+	ref, _ := ParseTableRef(table)
+	return ref.String() + "\x00" + strings.Join(slices.Sorted(slices.Values(uniqueKeys)), "\x00")
+}
+
+// autoTableQuery reports the planner's row estimate, whether the current user owns the
+// table and whether a plain unique index covers exactly the key columns $3. $3 is sorted
+// bytewise by slices.Sorted, so the index columns are sorted in the "C" collation.
+// Like introspectColumnsQuery it looks the table up by name $1 in schema $2, or in the
+// current schema. reltuples is -1 for tables never vacuumed or analyzed, whose size is
+// unknown.
+const autoTableQuery = `SELECT c.reltuples::bigint, pg_has_role(c.relowner, 'USAGE'),
+	EXISTS (
+		SELECT 1 FROM pg_index i
+		WHERE i.indrelid = c.oid AND i.indisunique AND i.indpred IS NULL AND i.indexprs IS NULL
+			AND (SELECT array_agg(a.attname::text ORDER BY a.attname::text COLLATE "C")
+				FROM pg_attribute a
+				WHERE a.attrelid = c.oid AND a.attnum = ANY ((i.indkey::int2[])[0:i.indnkeyatts - 1])) = $3::text[]
+	)
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = COALESCE(NULLIF($2, ''), current_schema()) AND c.relname = $1`
+
+// Decide inspects the table and rows and returns the strategy Upsert would use,
+// without writing anything.
+func (a *AutoUpserter) Decide(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) (Decision, error) {
+	if a.dialect != Postgres {
+		return Decision{}, fmt.Errorf("auto strategy selection needs PostgreSQL, not %s", a.dialect.Name())
+	}
+	if len(columns) == 0 {
+		return Decision{}, errors.New("at least one column is required")
+	}
+	if len(uniqueKeys) == 0 {
+		return Decision{}, errors.New("at least one unique key is required")
+	}
+	ref, err := ParseTableRef(table)
+	if err != nil {
+		return Decision{}, fmt.Errorf("table: %w", err)
+	}
+	tableIdent, err := a.quoteTable(table)
+	if err != nil {
+		return Decision{}, fmt.Errorf("table: %w", err)
+	}
+	keyIndexes := make([]int, len(uniqueKeys))
+	for i, key := range uniqueKeys {
+		if keyIndexes[i] = slices.Index(columns, key); keyIndexes[i] < 0 {
+			return Decision{}, fmt.Errorf("unique key %q not found in columns", key)
+		}
+	}
+
+	d := Decision{Rows: len(rows), RowBytes: estimateRowBytes(rows)}
+	key := autoFactsKey(table, uniqueKeys)
+	a.mu.Lock()
+	facts, cached := a.facts[key]
+	a.mu.Unlock()
+	if !cached {
+		sortedKeys := slices.Sorted(slices.Values(uniqueKeys))
+		err = a.db.QueryRowContext(ctx, autoTableQuery, ref.Name, ref.Schema, pq.Array(sortedKeys)).
+			Scan(&d.EstimatedTuples, &d.CanCreateIndex, &d.HasUniqueIndex)
+		if errors.Is(err, sql.ErrNoRows) {
+			return Decision{}, fmt.Errorf("inspect table: table %q not found", table)
+		}
+		if err != nil {
+			return Decision{}, fmt.Errorf("inspect table: %w", err)
+		}
+
+		// Without an index the lookup scans the table, so only small tables of known
+		// size are sampled.
+		if d.HasUniqueIndex || d.EstimatedTuples >= 0 && d.EstimatedTuples < autoSampleMaxTuples {
+			if err := a.sampleConflicts(ctx, &d, tableIdent, uniqueKeys, keyIndexes, rows); err != nil {
+				return Decision{}, err
+			}
+		}
+		facts = autoTableFacts{d.EstimatedTuples, d.CanCreateIndex, d.HasUniqueIndex, d.SampledKeys, d.ExistingKeys}
+		a.mu.Lock()
+		a.facts[key] = facts
+		a.mu.Unlock()
+	}
+	d.EstimatedTuples, d.CanCreateIndex, d.HasUniqueIndex = facts.estimatedTuples, facts.canCreateIndex, facts.hasUniqueIndex
+	d.SampledKeys, d.ExistingKeys = facts.sampledKeys, facts.existingKeys
+
+	keyList := strings.Join(uniqueKeys, ", ")
+	switch {
+	case d.HasUniqueIndex:
+		d.Reasons = append(d.Reasons, fmt.Sprintf("a unique index covers (%s)", keyList))
+	case d.CanCreateIndex:
+		d.Reasons = append(d.Reasons, fmt.Sprintf("no unique index covers (%s), but the current user owns the table and can create one", keyList))
+	default:
+		d.Strategy = "naive"
+		d.Reasons = append(d.Reasons, fmt.Sprintf("no unique index covers (%s) and the current user cannot create one, so ON CONFLICT is impossible", keyList))
+		return d, nil
+	}
+
+	width := len(columns)
+	if len(rows) <= autoMaxHashRows && len(rows)*width <= a.dialect.MaxPlaceholders() {
+		d.Strategy = "hash"
+		d.Reasons = append(d.Reasons, fmt.Sprintf("%d rows fit one statement", len(rows)))
+		return d, nil
+	}
+
+	d.Strategy = "batched"
+	d.BatchSize = min(max(autoTargetBatchBytes/max(d.RowBytes, 1), autoMinBatchSize), autoMaxBatchSize)
+	d.Reasons = append(d.Reasons, fmt.Sprintf("%d rows of about %d bytes are batched by ~%d KiB", len(rows), d.RowBytes, autoTargetBatchBytes>>10))
+	if ratio := d.ConflictRatio(); ratio > autoUpdateHeavy {
+		d.BatchSize = max(d.BatchSize/2, autoMinBatchSize)
+		d.Reasons = append(d.Reasons, fmt.Sprintf("%.0f%% of sampled keys exist, so batches are halved to hold row locks for less time", ratio*100))
+	}
+	if limit := a.dialect.MaxPlaceholders() / width; d.BatchSize > limit {
+		d.BatchSize = limit
+		d.Reasons = append(d.Reasons, fmt.Sprintf("%d columns limit a statement to %d rows", width, limit))
+	}
+	return d, nil
+}
+
+// sampleConflicts counts how many of up to autoSampleKeys evenly spaced keys of rows
+// are already in the table.
+func (a *AutoUpserter) sampleConflicts(ctx context.Context, d *Decision, tableIdent string, uniqueKeys []string, keyIndexes []int, rows [][]any) error {
+	sample := min(len(rows), autoSampleKeys)
+	if sample == 0 {
+		return nil
+	}
+	quotedKeys := make([]string, len(uniqueKeys))
+	for i, key := range uniqueKeys {
+		quoted, err := a.quote(key)
+		if err != nil {
+			return fmt.Errorf("unique key %q: %w", key, err)
+		}
+		quotedKeys[i] = quoted
+	}
+
+	args := make([]any, 0, sample*len(keyIndexes))
+	for i := range sample {
+		row := rows[i*len(rows)/sample]
+		if len(row) <= slices.Max(keyIndexes) {
+			return fmt.Errorf("row %d: too few values", i*len(rows)/sample)
+		}
+		args = append(args, pick(row, keyIndexes)...)
+	}
+	keyList := strings.Join(quotedKeys, ", ")
+	tuples := placeholderRows(a.dialect, len(keyIndexes), sample)
+	var query string
+	if len(keyIndexes) == 1 {
+		query = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s IN (%s)", tableIdent, keyList, strings.Join(tuples, ", "))
+	} else {
+		query = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE (%s) IN ((%s))", tableIdent, keyList, strings.Join(tuples, "), ("))
+	}
+
+	a.logStatement(ctx, query, args)
+	if err := a.db.QueryRowContext(ctx, query, args...).Scan(&d.ExistingKeys); err != nil {
+		return fmt.Errorf("sample existing keys: %w", err)
+	}
+	d.SampledKeys = sample
+	d.ExistingKeys = min(d.ExistingKeys, sample)
+	return nil
+}
+
+// estimateRowBytes estimates the size of one row's values from up to autoSampleKeys rows.
+func estimateRowBytes(rows [][]any) int {
+	sample := min(len(rows), autoSampleKeys)
+	if sample == 0 {
+		return 0
+	}
+	total := 0
+	for i := range sample {
+		for _, v := range rows[i*len(rows)/sample] {
+			switch v := v.(type) {
+			case nil:
+				total++
+			case string:
+				total += len(v)
+			case []byte:
+				total += len(v)
+			default:
+				total += 8
+			}
+		}
+	}
+	return max(total/sample, 1)
+}
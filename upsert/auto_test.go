@@ -0,0 +1,204 @@
+package upsert
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func expectAutoTable(mock sqlmock.Sqlmock, tuples int64, owner, indexed bool) {
+	mock.ExpectQuery(regexp.QuoteMeta(autoTableQuery)).
+		WithArgs("users", "", `{"id"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"reltuples", "owner", "indexed"}).AddRow(tuples, owner, indexed))
+}
+
+func TestAutoUpserter_SmallInputUsesHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	expectAutoTable(mock, 1000, false, true)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM "users" WHERE "id" IN ($1, $2)`)).
+		WithArgs(int64(1), int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	// The user does not own the table, and the existing index makes the DDL unnecessary.
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`)).
+		WithArgs(int64(1), "John", int64(2), "Jane").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	var d Decision
+	rows := [][]any{{int64(1), "John"}, {int64(2), "Jane"}}
+	if err := NewAutoUpserter(db).Upsert(WithDecision(context.Background(), &d), "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if d.Strategy != "hash" || d.BatchSize != 0 || !d.HasUniqueIndex || d.SampledKeys != 2 || d.ExistingKeys != 1 {
+		t.Fatalf("decision = %+v", d)
+	}
+	if got := d.ConflictRatio(); got != 0.5 {
+		t.Fatalf("ConflictRatio() = %v, want 0.5", got)
+	}
+	if want := "hash: a unique index covers (id); 2 rows fit one statement"; d.String() != want {
+		t.Fatalf("String() = %q, want %q", d.String(), want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAutoUpserter_NoIndexWithoutOwnershipUsesNaive(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	// A large table without an index is not sampled.
+	expectAutoTable(mock, 5_000_000, false, false)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT 1 FROM "users" WHERE "id" = $1 LIMIT 1`)).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id", "name") VALUES ($1, $2)`)).
+		WithArgs(int64(1), "John").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var d Decision
+	if err := NewAutoUpserter(db).Upsert(WithDecision(context.Background(), &d), "users", []string{"id", "name"}, [][]any{{int64(1), "John"}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if d.Strategy != "naive" || d.SampledKeys != 0 || d.ConflictRatio() != -1 {
+		t.Fatalf("decision = %+v", d)
+	}
+	if !strings.Contains(d.String(), "ON CONFLICT is impossible") {
+		t.Fatalf("String() = %q", d.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAutoUpserter_DecideBatched(t *testing.T) {
+	rows := generateBenchmarkRows(2000)
+	columns := []string{"id", "name"}
+
+	tests := []struct {
+		name      string
+		existing  int
+		batchSize int
+	}{
+		{"insertHeavy", 10, autoMaxBatchSize},
+		{"updateHeavy", 80, autoMaxBatchSize / 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer db.Close()
+
+			expectAutoTable(mock, 1000, true, false)
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM "users" WHERE "id" IN (`)).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tc.existing))
+
+			d, err := NewAutoUpserter(db).Decide(context.Background(), "users", columns, rows, []string{"id"})
+			if err != nil {
+				t.Fatalf("Decide: %v", err)
+			}
+			if d.Strategy != "batched" || d.BatchSize != tc.batchSize || !d.CanCreateIndex || d.SampledKeys != autoSampleKeys {
+				t.Fatalf("decision = %+v", d)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestAutoUpserter_UnknownSizeSkipsSampling(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	// A never analyzed table of unknown size is not sampled without an index.
+	expectAutoTable(mock, -1, true, false)
+
+	d, err := NewAutoUpserter(db).Decide(context.Background(), "users", []string{"id", "name"}, generateBenchmarkRows(2000), []string{"id"})
+	if err != nil {
+		t.Fatalf("Decide: %v", err)
+	}
+	if d.Strategy != "batched" || d.SampledKeys != 0 || d.EstimatedTuples != -1 {
+		t.Fatalf("decision = %+v", d)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAutoUpserter_CachesTableFacts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	insert := regexp.QuoteMeta(`INSERT INTO "users" ("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`)
+	expectAutoTable(mock, 1000, true, false)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM "users" WHERE "id" IN ($1)`)).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).WithArgs(int64(1), "John").WillReturnResult(sqlmock.NewResult(0, 1))
+	// The second chunk neither inspects the table nor creates the index again.
+	mock.ExpectExec(insert).WithArgs(int64(2), "Jane").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	auto := NewAutoUpserter(db)
+	ctx := context.Background()
+	for _, row := range [][]any{{int64(1), "John"}, {int64(2), "Jane"}} {
+		if err := auto.Upsert(ctx, "users", []string{"id", "name"}, [][]any{row}, []string{"id"}); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAutoUpserter_DecideErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	rows := [][]any{{int64(1), "John"}}
+	if _, err := NewAutoUpserter(db, WithDialect(MySQL)).Decide(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err == nil {
+		t.Fatal("expected error for MySQL, got nil")
+	}
+	if _, err := NewAutoUpserter(db).Decide(context.Background(), "users", []string{"id", "name"}, rows, []string{"email"}); err == nil {
+		t.Fatal("expected error for unknown unique key, got nil")
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(autoTableQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"reltuples", "owner", "indexed"}))
+	if _, err := NewAutoUpserter(db).Decide(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected missing table error, got %v", err)
+	}
+}
+
+func TestEstimateRowBytes(t *testing.T) {
+	rows := [][]any{{int64(1), "abcd", nil, []byte("xy")}, {int64(2), "abcdef", nil, []byte("xy")}}
+	// (8+4+1+2 + 8+6+1+2) / 2
+	if got := estimateRowBytes(rows); got != 16 {
+		t.Fatalf("estimateRowBytes() = %d, want 16", got)
+	}
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 )
 
 type BatchedHashIndexedUpserter struct {
 	db        *sql.DB
 	batchSize int
+	options
+
+	checkpoints CheckpointStore
+	jobID       string
 }
 
-func NewBatchedHashIndexedUpserter(db *sql.DB) Upserter {
-	return &BatchedHashIndexedUpserter{db: db, batchSize: 500}
+func NewBatchedHashIndexedUpserter(db *sql.DB, opts ...Option) Upserter {
+	return &BatchedHashIndexedUpserter{db: db, batchSize: 500, options: newOptions(opts)}
 }
 
 // WithBatchSize returns a shallow copy with an overridden batch size for testing and tuning.
@@ -22,7 +28,23 @@ func (b *BatchedHashIndexedUpserter) WithBatchSize(size int) Upserter {
 	return &clone
 }
 
+// WithCheckpoint returns a shallow copy that records progress under jobID after every
+// committed batch. Calling Upsert again with the same job ID and input resumes after
+// the last committed batch; a completed job is not run again.
+func (b *BatchedHashIndexedUpserter) WithCheckpoint(store CheckpointStore, jobID string) Upserter {
+	clone := *b
+	clone.checkpoints = store
+	clone.jobID = jobID
+	return &clone
+}
+
 func (b *BatchedHashIndexedUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	return b.instrument(ctx, "batched", table, columns, rows, true, func(ctx context.Context) error {
+		return b.upsert(ctx, table, columns, rows, uniqueKeys)
+	})
+}
+
+func (b *BatchedHashIndexedUpserter) upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
 	if len(columns) == 0 {
 		return errors.New("at least one column is required")
 	}
@@ -36,12 +58,81 @@ func (b *BatchedHashIndexedUpserter) Upsert(ctx context.Context, table string, c
 		return errors.New("batch size must be positive")
 	}
 
-	mut := NewHashIndexedUpserter(b.db)
-	for start := 0; start < len(rows); start += b.batchSize {
-		end := min(start+b.batchSize, len(rows))
-		if err := mut.Upsert(ctx, table, columns, rows[start:end], uniqueKeys); err != nil {
+	batchSize := b.effectiveBatchSize(len(columns))
+	mut := &HashIndexedUpserter{db: b.db, options: b.options}
+	if b.checkpoints == nil {
+		for start := 0; start < len(rows); start += batchSize {
+			end := min(start+batchSize, len(rows))
+			if err := b.upsertBatch(ctx, mut, table, columns, rows, uniqueKeys, start, end); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cp, hasher, err := b.resume(ctx, rows)
+	if err != nil {
+		return err
+	}
+	if meter := progressFromContext(ctx); meter != nil {
+		meter.Skip(cp.Offset)
+	}
+	for start := cp.Offset; start < len(rows); start += batchSize {
+		end := min(start+batchSize, len(rows))
+		if err := b.upsertBatch(ctx, mut, table, columns, rows, uniqueKeys, start, end); err != nil {
 			return err
 		}
+
+		hasher.write(rows[start:end])
+		cp.Offset = end
+		cp.Batches++
+		cp.InputHash = hasher.sum()
+		if end == len(rows) {
+			cp.State = JobCompleted
+		}
+		cp.UpdatedAt = time.Now().UTC()
+		if err := b.checkpoints.Save(ctx, cp); err != nil {
+			return fmt.Errorf("job %q: rows up to %d committed: %w", b.jobID, end, err)
+		}
 	}
 	return nil
 }
+
+// upsertBatch upserts rows[start:end] in its own span and observes it as a batch.
+func (b *BatchedHashIndexedUpserter) upsertBatch(ctx context.Context, mut *HashIndexedUpserter, table string, columns []string, rows [][]any, uniqueKeys []string, start, end int) error {
+	ctx, span := b.startSpan(ctx, "upsert.batch", batchAttributes(start, end)...)
+	began := time.Now()
+	err := mut.upsert(ctx, table, columns, rows[start:end], uniqueKeys)
+	b.observeBatch(ctx, table, start, end-start, time.Since(began), err)
+	endSpan(span, err)
+	return err
+}
+
+// effectiveBatchSize lowers the configured batch size so one batch stays within the
+// dialect's bind parameter limit.
+func (b *BatchedHashIndexedUpserter) effectiveBatchSize(columns int) int {
+	return max(1, min(b.batchSize, b.dialect.MaxPlaceholders()/columns))
+}
+
+// resume loads the job's checkpoint and verifies that rows starts with the input it
+// recorded. It returns the checkpoint to continue from and a hasher primed with the
+// already committed rows.
+func (b *BatchedHashIndexedUpserter) resume(ctx context.Context, rows [][]any) (Checkpoint, *inputHasher, error) {
+	hasher := newInputHasher()
+	saved, found, err := b.checkpoints.Load(ctx, b.jobID)
+	if err != nil {
+		return Checkpoint{}, nil, fmt.Errorf("job %q: %w", b.jobID, err)
+	}
+	if !found {
+		return Checkpoint{JobID: b.jobID, Total: len(rows), State: JobRunning}, hasher, nil
+	}
+
+	if saved.Total != len(rows) || saved.Offset > len(rows) {
+		return Checkpoint{}, nil, fmt.Errorf("job %q: checkpoint is for %d input rows, got %d", b.jobID, saved.Total, len(rows))
+	}
+	hasher.write(rows[:saved.Offset])
+	if hasher.sum() != saved.InputHash {
+		return Checkpoint{}, nil, fmt.Errorf("job %q: input differs from the checkpointed input", b.jobID)
+	}
+	return saved, hasher, nil
+}
@@ -2,6 +2,7 @@ package upsert
 
 import (
 	"context"
+	"errors"
 	"regexp"
 	"testing"
 
@@ -61,3 +62,64 @@ func TestBatchedHashIndexedUpserterUpsert_InvalidBatchSize(t *testing.T) {
 		t.Fatal("expected error for non-positive batch size, got nil")
 	}
 }
+
+func TestBatchedHashIndexedUpserterUpsert_ResumesFromCheckpoint(t *testing.T) {
+	columns := []string{"id", "name"}
+	rows := [][]any{
+		{1, "a"},
+		{2, "b"},
+		{3, "c"},
+	}
+	uniqueKeys := []string{"id"}
+	store := NewFileCheckpointStore(t.TempDir())
+	ctx := context.Background()
+
+	// The first run commits one batch and then fails.
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	base := NewBatchedHashIndexedUpserter(db).(*BatchedHashIndexedUpserter).WithBatchSize(2).(*BatchedHashIndexedUpserter)
+	upserter := base.WithCheckpoint(store, "load_users")
+
+	mock.ExpectExec(`CREATE UNIQUE INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "users"`).WithArgs(1, "a", 2, "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`CREATE UNIQUE INDEX`).WillReturnError(errors.New("connection reset"))
+
+	if err := upserter.Upsert(ctx, "users", columns, rows, uniqueKeys); err == nil {
+		t.Fatal("expected error from failed batch, got nil")
+	}
+	cp, err := JobStatus(ctx, store, "load_users")
+	if err != nil {
+		t.Fatalf("JobStatus: %v", err)
+	}
+	if cp.Offset != 2 || cp.Batches != 1 || cp.State != JobRunning {
+		t.Fatalf("checkpoint after failure = %+v", cp)
+	}
+
+	// Resuming only sends the remaining row.
+	mock.ExpectExec(`CREATE UNIQUE INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "users"`).WithArgs(3, "c").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := upserter.Upsert(ctx, "users", columns, rows, uniqueKeys); err != nil {
+		t.Fatalf("resumed Upsert: %v", err)
+	}
+	if cp, _ = JobStatus(ctx, store, "load_users"); cp.Offset != 3 || cp.State != JobCompleted {
+		t.Fatalf("checkpoint after resume = %+v", cp)
+	}
+
+	// A completed job is a no-op, and a different input is rejected.
+	if err := upserter.Upsert(ctx, "users", columns, rows, uniqueKeys); err != nil {
+		t.Fatalf("completed Upsert: %v", err)
+	}
+	changed := [][]any{{1, "z"}, {2, "b"}, {3, "c"}}
+	if err := upserter.Upsert(ctx, "users", columns, changed, uniqueKeys); err == nil {
+		t.Fatal("expected error for changed input, got nil")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
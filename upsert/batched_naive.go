@@ -0,0 +1,213 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BatchedNaiveUpserter decides between insert and update like NaiveUpserter, but per
+// batch: one query finds which rows' keys already exist, then one multi-row INSERT adds the new
+// rows and one UPDATE ... FROM overwrites the existing ones. Dialects without
+// UPDATE ... FROM (MySQL) fall back to one UPDATE per existing row.
+//
+// It needs no unique index, so it works on tables where ON CONFLICT is impossible. Each
+// batch runs in its own transaction and, like NaiveUpserter, nothing stops a concurrent
+// writer from inserting a key between the check and the INSERT. It does not use a
+// statement cache, since its statement shapes depend on how many rows already exist.
+type BatchedNaiveUpserter struct {
+	db        *sql.DB
+	batchSize int
+	options
+}
+
+func NewBatchedNaiveUpserter(db *sql.DB, opts ...Option) Upserter {
+	return &BatchedNaiveUpserter{db: db, batchSize: 500, options: newOptions(opts)}
+}
+
+// WithBatchSize returns a shallow copy with an overridden batch size for testing and tuning.
+func (b *BatchedNaiveUpserter) WithBatchSize(size int) Upserter {
+	clone := *b
+	clone.batchSize = size
+	return &clone
+}
+
+func (b *BatchedNaiveUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	return b.instrument(ctx, "batched-naive", table, columns, rows, true, func(ctx context.Context) error {
+		return b.upsert(ctx, table, columns, rows, uniqueKeys)
+	})
+}
+
+func (b *BatchedNaiveUpserter) upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	if b.batchSize <= 0 {
+		return errors.New("batch size must be positive")
+	}
+	plan, err := newUpsertPlan(b.options, table, columns, rows, uniqueKeys)
+	if err != nil {
+		return err
+	}
+
+	keyIndexes := make([]int, len(uniqueKeys))
+	for i, key := range uniqueKeys {
+		keyIndexes[i] = slices.Index(columns, key)
+	}
+
+	batchSize := max(1, min(b.batchSize, b.dialect.MaxPlaceholders()/len(columns)))
+	for start := 0; start < len(rows); start += batchSize {
+		end := min(start+batchSize, len(rows))
+		batchCtx, span := b.startSpan(ctx, "upsert.batch", batchAttributes(start, end)...)
+		began := time.Now()
+		err := b.upsertBatch(batchCtx, table, plan, keyIndexes, rows[start:end])
+		b.observeBatch(ctx, table, start, end-start, time.Since(began), err)
+		endSpan(span, err)
+		if err != nil {
+			return fmt.Errorf("rows %d-%d: %w", start, end-1, err)
+		}
+	}
+	return nil
+}
+
+func (b *BatchedNaiveUpserter) upsertBatch(ctx context.Context, table string, plan upsertPlan, keyIndexes []int, rows [][]any) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := b.takeAdvisoryLocks(ctx, tx, plan.tableIdent, plan.quotedUniqueKeys, rows, keyIndexes); err != nil {
+		return err
+	}
+	existing, err := b.existingRows(ctx, tx, plan, keyIndexes, rows)
+	if err != nil {
+		return err
+	}
+
+	var inserts, updates [][]any
+	for i, row := range rows {
+		if existing[i] {
+			updates = append(updates, row)
+		} else {
+			inserts = append(inserts, row)
+		}
+	}
+
+	if len(inserts) > 0 {
+		query, args := plan.insertRows(len(inserts)), flatten(inserts)
+		b.logStatement(ctx, query, args)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("insert rows: %w", err)
+		}
+	}
+	if len(updates) > 0 && len(plan.updateColumns) > 0 {
+		if err := b.updateRows(ctx, tx, plan, keyIndexes, updates); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	committed = true
+	if stats := statsFromContext(ctx); stats != nil {
+		stats.add(int64(len(rows)), int64(len(inserts)), int64(len(updates)))
+	}
+	return nil
+}
+
+// existingRows reports for each of rows whether its unique key values are already in
+// the table. The database matches the keys, so values that render differently from what
+// it stores, such as an uppercase UUID or 1.0 for numeric 1.00, still match.
+func (b *BatchedNaiveUpserter) existingRows(ctx context.Context, tx *sql.Tx, plan upsertPlan, keyIndexes []int, rows [][]any) ([]bool, error) {
+	args := make([]any, 0, len(rows)*len(keyIndexes))
+	for _, row := range rows {
+		args = append(args, pick(row, keyIndexes)...)
+	}
+	query := plan.dialect.ExistingRows(plan.tableIdent, plan.quotedUniqueKeys, len(rows))
+
+	b.logStatement(ctx, query, args)
+	result, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("check existing rows: %w", err)
+	}
+	defer result.Close()
+
+	existing := make([]bool, len(rows))
+	for result.Next() {
+		var ord int64
+		if err := result.Scan(&ord); err != nil {
+			return nil, fmt.Errorf("scan existing row: %w", err)
+		}
+		if ord < 0 || ord >= int64(len(rows)) {
+			return nil, fmt.Errorf("check existing rows: ordinal %d out of range", ord)
+		}
+		existing[ord] = true
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("check existing rows: %w", err)
+	}
+	return existing, nil
+}
+
+func (b *BatchedNaiveUpserter) updateRows(ctx context.Context, tx *sql.Tx, plan upsertPlan, keyIndexes []int, rows [][]any) error {
+	if query := plan.dialect.UpdateFrom(plan.tableIdent, plan.quotedColumns, plan.updateColumns, plan.quotedUniqueKeys, len(rows)); query != "" {
+		args := flatten(rows)
+		b.logStatement(ctx, query, args)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("update rows: %w", err)
+		}
+		return nil
+	}
+
+	columnIndexes := make([]int, 0, len(plan.updateColumns))
+	setClauses := make([]string, 0, len(plan.updateColumns))
+	for i, col := range plan.quotedColumns {
+		if slices.Contains(plan.updateColumns, col) {
+			columnIndexes = append(columnIndexes, i)
+			setClauses = append(setClauses, fmt.Sprintf("%s = %s", col, plan.dialect.Placeholder(len(setClauses)+1)))
+		}
+	}
+	whereClauses := make([]string, len(keyIndexes))
+	for i, key := range plan.quotedUniqueKeys {
+		whereClauses[i] = fmt.Sprintf("%s = %s", key, plan.dialect.Placeholder(len(setClauses)+i+1))
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", plan.tableIdent, strings.Join(setClauses, ", "), strings.Join(whereClauses, " AND "))
+
+	for _, row := range rows {
+		args := append(pick(row, columnIndexes), pick(row, keyIndexes)...)
+		b.logStatement(ctx, query, args)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("update row: %w", err)
+		}
+	}
+	return nil
+}
+
+// pick returns the values of row at indexes.
+func pick(row []any, indexes []int) []any {
+	values := make([]any, len(indexes))
+	for i, idx := range indexes {
+		values[i] = row[idx]
+	}
+	return values
+}
+
+func flatten(rows [][]any) []any {
+	if len(rows) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(rows)*len(rows[0]))
+	for _, row := range rows {
+		args = append(args, row...)
+	}
+	return args
+}
@@ -0,0 +1,140 @@
+package upsert
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBatchedNaiveUpserterUpsert_Postgres(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewBatchedNaiveUpserter(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT v.ord FROM (SELECT "id", 0 AS ord FROM "users" WHERE false UNION ALL SELECT $1, 0 UNION ALL SELECT $2, 1 UNION ALL SELECT $3, 2) AS v WHERE EXISTS (SELECT 1 FROM "users" WHERE "users"."id" = v."id")`)).
+		WithArgs(int64(1), int64(2), int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"ord"}).AddRow(int64(1)))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4)`)).
+		WithArgs(int64(1), "John", int64(3), "Joe").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "name" = v."name" FROM (SELECT "id", "name" FROM "users" WHERE false UNION ALL SELECT $1, $2) AS v WHERE "users"."id" = v."id"`)).
+		WithArgs(int64(2), "Jane").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var stats Stats
+	ctx := WithStats(context.Background(), &stats)
+	rows := [][]any{{int64(1), "John"}, {int64(2), "Jane"}, {int64(3), "Joe"}}
+	if err := upserter.Upsert(ctx, "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if stats.Rows() != 3 || stats.Inserted() != 2 || stats.Updated() != 1 {
+		t.Fatalf("stats = rows %d inserted %d updated %d, want 3/2/1", stats.Rows(), stats.Inserted(), stats.Updated())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestBatchedNaiveUpserterUpsert_CompositeKeyBatches(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewBatchedNaiveUpserter(db).(*BatchedNaiveUpserter).WithBatchSize(2)
+
+	existsQuery := regexp.QuoteMeta(`SELECT v.ord FROM (SELECT "tenant", "id", 0 AS ord FROM "members" WHERE false UNION ALL SELECT $1, $2, 0 UNION ALL SELECT $3, $4, 1) AS v WHERE EXISTS (SELECT 1 FROM "members" WHERE "members"."tenant" = v."tenant" AND "members"."id" = v."id")`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(existsQuery).
+		WithArgs("acme", int64(1), "acme", int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"ord"}).AddRow(int64(0)).AddRow(int64(1)))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT v.ord FROM (SELECT "tenant", "id", 0 AS ord FROM "members" WHERE false UNION ALL SELECT $1, $2, 0) AS v`)).
+		WithArgs("globex", int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"ord"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "members" ("tenant", "id") VALUES ($1, $2)`)).
+		WithArgs("globex", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rows := [][]any{{"acme", int64(1)}, {"acme", int64(2)}, {"globex", int64(1)}}
+	if err := upserter.Upsert(context.Background(), "members", []string{"tenant", "id"}, rows, []string{"tenant", "id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestBatchedNaiveUpserterUpsert_MySQLUpdatesPerRow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewBatchedNaiveUpserter(db, WithDialect(MySQL))
+
+	update := regexp.QuoteMeta("UPDATE `users` SET `name` = ? WHERE `id` = ?")
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT v.ord FROM (SELECT `id`, 0 AS ord FROM `users` WHERE false UNION ALL SELECT ?, 0 UNION ALL SELECT ?, 1) AS v WHERE EXISTS (SELECT 1 FROM `users` WHERE `users`.`id` = v.`id`)")).
+		WithArgs(int64(1), int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"ord"}).AddRow(int64(0)).AddRow(int64(1)))
+	mock.ExpectExec(update).WithArgs("John", int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(update).WithArgs("Jane", int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rows := [][]any{{int64(1), "John"}, {int64(2), "Jane"}}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestBatchedNaiveUpserterUpsert_InvalidBatchSize(t *testing.T) {
+	upserter := &BatchedNaiveUpserter{batchSize: 0}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{1}}, []string{"id"}); err == nil {
+		t.Fatal("expected error for invalid batch size, got nil")
+	}
+}
+
+func TestBatchedNaiveUpserterUpsert_MatchesKeysInColumnType(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewBatchedNaiveUpserter(db)
+
+	// The stored key renders as lowercase text; the input UUID is uppercase. The row
+	// still counts as existing because the database reports it by ordinal.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT v.ord FROM`)).
+		WithArgs("6BA7B810-9DAD-11D1-80B4-00C04FD430C8").
+		WillReturnRows(sqlmock.NewRows([]string{"ord"}).AddRow(int64(0)))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "name" = v."name"`)).
+		WithArgs("6BA7B810-9DAD-11D1-80B4-00C04FD430C8", "John").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rows := [][]any{{"6BA7B810-9DAD-11D1-80B4-00C04FD430C8", "John"}}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
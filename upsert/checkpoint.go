@@ -0,0 +1,228 @@
+package upsert
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JobState is the lifecycle state of a checkpointed load.
+type JobState string
+
+const (
+	JobRunning   JobState = "running"
+	JobCompleted JobState = "completed"
+)
+
+// ErrJobNotFound is returned by JobStatus for job IDs without a checkpoint.
+var ErrJobNotFound = errors.New("job not found")
+
+// Checkpoint records how far a batched load has committed.
+type Checkpoint struct {
+	JobID string `json:"job_id"`
+	// Offset is the number of input rows committed so far.
+	Offset  int `json:"offset"`
+	Batches int `json:"batches"`
+	Total   int `json:"total"`
+	// InputHash is a hex SHA-256 over the rows before Offset, used to make sure a
+	// resumed load is fed the same input.
+	InputHash string `json:"input_hash"`
+	// Position is where a load that pages by key rather than by offset resumes, in a
+	// form of its choosing; upsert-sync stores its last key as JSON.
+	Position  string    `json:"position,omitempty"`
+	State     JobState  `json:"state"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CheckpointStore persists checkpoints by job ID.
+type CheckpointStore interface {
+	// Load returns the checkpoint for jobID and whether one exists.
+	Load(ctx context.Context, jobID string) (Checkpoint, bool, error)
+	Save(ctx context.Context, cp Checkpoint) error
+}
+
+// JobStatus returns the latest checkpoint of a job, or ErrJobNotFound.
+func JobStatus(ctx context.Context, store CheckpointStore, jobID string) (Checkpoint, error) {
+	cp, found, err := store.Load(ctx, jobID)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if !found {
+		return Checkpoint{}, fmt.Errorf("%w: %q", ErrJobNotFound, jobID)
+	}
+	return cp, nil
+}
+
+// FileCheckpointStore keeps one JSON file per job in a directory.
+type FileCheckpointStore struct {
+	dir string
+}
+
+func NewFileCheckpointStore(dir string) *FileCheckpointStore {
+	return &FileCheckpointStore{dir: dir}
+}
+
+func (s *FileCheckpointStore) Load(_ context.Context, jobID string) (Checkpoint, bool, error) {
+	path, err := s.path(jobID)
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Checkpoint{}, false, nil
+	}
+	if err != nil {
+		return Checkpoint{}, false, fmt.Errorf("load checkpoint: %w", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return Checkpoint{}, false, fmt.Errorf("load checkpoint %s: %w", path, err)
+	}
+	return cp, true, nil
+}
+
+// Save writes the checkpoint through a temporary file and rename so readers never see a partial file.
+func (s *FileCheckpointStore) Save(_ context.Context, cp Checkpoint) error {
+	path, err := s.path(cp.JobID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, cp.JobID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (s *FileCheckpointStore) path(jobID string) (string, error) {
+	if !isSafeIdentifier(jobID) {
+		return "", fmt.Errorf("invalid job ID %q", jobID)
+	}
+	return filepath.Join(s.dir, jobID+".json"), nil
+}
+
+// TableCheckpointStore keeps checkpoints in a database table, one row per job.
+type TableCheckpointStore struct {
+	db    *sql.DB
+	table string
+}
+
+func NewTableCheckpointStore(db *sql.DB, table string) *TableCheckpointStore {
+	return &TableCheckpointStore{db: db, table: table}
+}
+
+// tableIdent quotes the configured table, which may be schema-qualified.
+func (s *TableCheckpointStore) tableIdent() (string, error) {
+	ref, err := ParseTableRef(s.table)
+	if err != nil {
+		return "", err
+	}
+	return ref.Quote(Postgres)
+}
+
+// EnsureTable creates the checkpoint table if it does not exist.
+func (s *TableCheckpointStore) EnsureTable(ctx context.Context) error {
+	tableIdent, err := s.tableIdent()
+	if err != nil {
+		return fmt.Errorf("checkpoint table: %w", err)
+	}
+	stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	job_id       TEXT PRIMARY KEY,
+	input_offset BIGINT NOT NULL,
+	batches      BIGINT NOT NULL,
+	total        BIGINT NOT NULL,
+	input_hash   TEXT NOT NULL,
+	position     TEXT NOT NULL,
+	state        TEXT NOT NULL,
+	updated_at   TIMESTAMPTZ NOT NULL
+)`, tableIdent)
+	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("create checkpoint table: %w", err)
+	}
+	return nil
+}
+
+func (s *TableCheckpointStore) Load(ctx context.Context, jobID string) (Checkpoint, bool, error) {
+	tableIdent, err := s.tableIdent()
+	if err != nil {
+		return Checkpoint{}, false, fmt.Errorf("checkpoint table: %w", err)
+	}
+	query := fmt.Sprintf(`SELECT job_id, input_offset, batches, total, input_hash, position, state, updated_at FROM %s WHERE job_id = $1`, tableIdent)
+
+	var cp Checkpoint
+	var state string
+	err = s.db.QueryRowContext(ctx, query, jobID).Scan(&cp.JobID, &cp.Offset, &cp.Batches, &cp.Total, &cp.InputHash, &cp.Position, &state, &cp.UpdatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Checkpoint{}, false, nil
+	case err != nil:
+		return Checkpoint{}, false, fmt.Errorf("load checkpoint: %w", err)
+	}
+	cp.State = JobState(state)
+	return cp, true, nil
+}
+
+func (s *TableCheckpointStore) Save(ctx context.Context, cp Checkpoint) error {
+	tableIdent, err := s.tableIdent()
+	if err != nil {
+		return fmt.Errorf("checkpoint table: %w", err)
+	}
+	stmt := fmt.Sprintf(`INSERT INTO %s (job_id, input_offset, batches, total, input_hash, position, state, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (job_id) DO UPDATE SET input_offset = EXCLUDED.input_offset, batches = EXCLUDED.batches, total = EXCLUDED.total, input_hash = EXCLUDED.input_hash, position = EXCLUDED.position, state = EXCLUDED.state, updated_at = EXCLUDED.updated_at`, tableIdent)
+	if _, err := s.db.ExecContext(ctx, stmt, cp.JobID, cp.Offset, cp.Batches, cp.Total, cp.InputHash, cp.Position, string(cp.State), cp.UpdatedAt); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// inputHasher hashes rows incrementally so the digest of any prefix is available.
+type inputHasher struct {
+	h hash.Hash
+}
+
+func newInputHasher() *inputHasher {
+	return &inputHasher{h: sha256.New()}
+}
+
+func (ih *inputHasher) write(rows [][]any) {
+	for _, row := range rows {
+		for _, val := range row {
+			fmt.Fprintf(ih.h, "%T:%v\x1f", val, val)
+		}
+		_, _ = ih.h.Write([]byte{'\x1e'})
+	}
+}
+
+func (ih *inputHasher) sum() string {
+	return hex.EncodeToString(ih.h.Sum(nil))
+}
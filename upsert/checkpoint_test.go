@@ -0,0 +1,84 @@
+package upsert
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFileCheckpointStore_RoundTrip(t *testing.T) {
+	store := NewFileCheckpointStore(t.TempDir())
+	ctx := context.Background()
+
+	if _, err := JobStatus(ctx, store, "load_users"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+
+	saved := Checkpoint{JobID: "load_users", Offset: 500, Batches: 1, Total: 1200, InputHash: "abc", Position: `[42]`, State: JobRunning, UpdatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if err := store.Save(ctx, saved); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := JobStatus(ctx, store, "load_users")
+	if err != nil {
+		t.Fatalf("JobStatus: %v", err)
+	}
+	if got != saved {
+		t.Fatalf("JobStatus() = %+v, want %+v", got, saved)
+	}
+
+	if err := store.Save(ctx, Checkpoint{JobID: "../escape"}); err == nil {
+		t.Fatal("expected error for unsafe job ID, got nil")
+	}
+}
+
+func TestTableCheckpointStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	store := NewTableCheckpointStore(db, "upsert_checkpoints")
+	ctx := context.Background()
+	updated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "upsert_checkpoints"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "upsert_checkpoints" (job_id, input_offset, batches, total, input_hash, position, state, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`)).
+		WithArgs("load_users", 500, 1, 1200, "abc", `[42]`, "running", updated).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT job_id, input_offset, batches, total, input_hash, position, state, updated_at FROM "upsert_checkpoints" WHERE job_id = $1`)).
+		WithArgs("load_users").
+		WillReturnRows(sqlmock.NewRows([]string{"job_id", "input_offset", "batches", "total", "input_hash", "position", "state", "updated_at"}).
+			AddRow("load_users", 500, 1, 1200, "abc", `[42]`, "running", updated))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT job_id`)).
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"job_id", "input_offset", "batches", "total", "input_hash", "position", "state", "updated_at"}))
+
+	if err := store.EnsureTable(ctx); err != nil {
+		t.Fatalf("EnsureTable: %v", err)
+	}
+	saved := Checkpoint{JobID: "load_users", Offset: 500, Batches: 1, Total: 1200, InputHash: "abc", Position: `[42]`, State: JobRunning, UpdatedAt: updated}
+	if err := store.Save(ctx, saved); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	got, found, err := store.Load(ctx, "load_users")
+	if err != nil || !found {
+		t.Fatalf("Load = found %v, err %v", found, err)
+	}
+	if got != saved {
+		t.Fatalf("Load() = %+v, want %+v", got, saved)
+	}
+	if _, found, err := store.Load(ctx, "missing"); err != nil || found {
+		t.Fatalf("Load(missing) = found %v, err %v", found, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,504 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Coercer converts loosely typed input values, such as CSV strings or decoded JSON, into
+// the Go types the drivers bind for each column:
+//
+//   - smallint, integer, bigint: int64 from strings, json.Number and whole floats
+//   - real, double precision: float64
+//   - numeric: the exact decimal text, so no precision is lost to float64
+//   - boolean: bool from PostgreSQL's spellings (t, yes, on, 1, ...) and 0/1
+//   - date, timestamp, timestamptz: time.Time from strings, and from numbers as Unix
+//     seconds only after WithUnixTimes
+//   - uuid: canonical lower-case text
+//   - arrays: a PostgreSQL array literal from JSON array text or Go slices
+//   - json, jsonb: JSON text from maps, slices and scalars
+//   - text types: strings from numbers and booleans
+//
+// Values of other types, NULLs and values for unknown columns are passed through.
+type Coercer struct {
+	columns     map[string]ColumnInfo
+	timeLayouts []string
+	unixTimes   bool
+}
+
+func NewCoercer(info []ColumnInfo) *Coercer {
+	columns := make(map[string]ColumnInfo, len(info))
+	for _, col := range info {
+		columns[col.Name] = col
+	}
+	return &Coercer{columns: columns}
+}
+
+// WithTimeLayouts returns a shallow copy that tries layouts, in time.Parse form, before the
+// built-in ISO 8601 layouts. Strings without a zone are read as UTC.
+func (c *Coercer) WithTimeLayouts(layouts ...string) *Coercer {
+	clone := *c
+	clone.timeLayouts = layouts
+	return &clone
+}
+
+// WithUnixTimes returns a shallow copy that reads numbers in time columns as Unix seconds.
+// Without it they are rejected, since a number may as well be milliseconds or a mistake.
+func (c *Coercer) WithUnixTimes() *Coercer {
+	clone := *c
+	clone.unixTimes = true
+	return &clone
+}
+
+// Coerce converts value for the named column.
+func (c *Coercer) Coerce(column string, value any) (any, error) {
+	col, ok := c.columns[column]
+	if !ok || value == nil {
+		return value, nil
+	}
+	return c.coerce(col, value)
+}
+
+// CoerceRows returns converted copies of rows, leaving rows untouched. If any value
+// cannot be converted it returns a *ValidationError listing all of them.
+func (c *Coercer) CoerceRows(columns []string, rows [][]any) ([][]any, error) {
+	coerced := make([][]any, len(rows))
+	var violations []Violation
+	for r, row := range rows {
+		out := make([]any, len(row))
+		for i, value := range row {
+			if i >= len(columns) {
+				out[i] = value
+				continue
+			}
+			converted, err := c.Coerce(columns[i], value)
+			if err != nil {
+				violations = append(violations, Violation{Row: r, Column: i, Name: columns[i], Value: value, Reason: err.Error()})
+				converted = value
+			}
+			out[i] = converted
+		}
+		coerced[r] = out
+	}
+	if len(violations) > 0 {
+		return nil, &ValidationError{Violations: violations}
+	}
+	return coerced, nil
+}
+
+func (c *Coercer) coerce(col ColumnInfo, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch v := value.(type) {
+	case []byte:
+		if col.UDTName == "bytea" {
+			return v, nil
+		}
+		value = string(v)
+	case json.Number:
+		value = string(v)
+	}
+
+	switch col.DataType {
+	case "smallint":
+		return coerceInteger(value, 16)
+	case "integer":
+		return coerceInteger(value, 32)
+	case "bigint":
+		return coerceInteger(value, 64)
+	case "numeric":
+		return coerceDecimal(value)
+	case "real", "double precision":
+		return coerceFloat(value)
+	case "boolean":
+		return coerceBool(value)
+	case "date", "timestamp without time zone", "timestamp with time zone":
+		return c.coerceTime(value)
+	case "uuid":
+		return coerceUUID(value)
+	case "ARRAY":
+		return c.coerceArray(col, value)
+	case "json", "jsonb":
+		return coerceJSON(value)
+	case "text", "character varying", "character":
+		return coerceText(value), nil
+	}
+	if col.UDTName == "citext" {
+		return coerceText(value), nil
+	}
+	return value, nil
+}
+
+// parseExactInteger parses a decimal number, possibly with a fraction or an exponent, and
+// reports whether it is exactly an integer.
+func parseExactInteger(s string) (*big.Int, bool) {
+	if s == "" || strings.Trim(s, "0123456789+-.eE") != "" {
+		return nil, false
+	}
+	// Bound the exponent before big.Rat expands it; larger ones are far outside int64.
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		if exp, err := strconv.Atoi(s[i+1:]); err != nil || exp < -400 || exp > 400 {
+			return nil, false
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || !r.IsInt() {
+		return nil, false
+	}
+	return r.Num(), true
+}
+
+func coerceInteger(value any, bits int) (any, error) {
+	lo, hi := int64(-1)<<(bits-1), int64(1)<<(bits-1)-1
+
+	var n int64
+	switch v := value.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			// Accept whole numbers in other notations, such as "1e3" or "2.0", exactly:
+			// through float64 values above 2^53 would round to another integer.
+			b, ok := parseExactInteger(s)
+			if !ok {
+				return nil, fmt.Errorf("%q is not an integer", v)
+			}
+			if !b.IsInt64() {
+				return nil, fmt.Errorf("%s is out of range [%d, %d]", s, lo, hi)
+			}
+			i = b.Int64()
+		}
+		n = i
+	case float32:
+		return coerceInteger(float64(v), bits)
+	case float64:
+		if v != math.Trunc(v) {
+			return nil, fmt.Errorf("%v is not an integer", v)
+		}
+		if reason := checkInteger(v, lo, hi); reason != "" {
+			return nil, errors.New(reason)
+		}
+		n = int64(v)
+	case bool:
+		return nil, errors.New("boolean in integer column")
+	default:
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = rv.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if rv.Uint() > math.MaxInt64 {
+				return nil, fmt.Errorf("%v is out of range [%d, %d]", value, lo, hi)
+			}
+			n = int64(rv.Uint())
+		default:
+			return value, nil
+		}
+	}
+	if reason := checkInteger(n, lo, hi); reason != "" {
+		return nil, errors.New(reason)
+	}
+	return n, nil
+}
+
+func coerceDecimal(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		if reason := checkNumeric(s, 0, 0); reason != "" {
+			return nil, errors.New(reason)
+		}
+		return s, nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return nil, errors.New("boolean in numeric column")
+	}
+	return value, nil
+}
+
+func coerceFloat(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", v)
+		}
+		return f, nil
+	case float32:
+		return float64(v), nil
+	case bool:
+		return nil, errors.New("boolean in floating-point column")
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	}
+	return value, nil
+}
+
+func coerceBool(value any) (any, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "t", "true", "y", "yes", "on", "1":
+			return true, nil
+		case "f", "false", "n", "no", "off", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%q is not a boolean", v)
+	case float64:
+		switch v {
+		case 0:
+			return false, nil
+		case 1:
+			return true, nil
+		}
+		return nil, fmt.Errorf("%v is not a boolean", v)
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := rv.Int(); n == 0 || n == 1 {
+			return n == 1, nil
+		}
+		return nil, fmt.Errorf("%v is not a boolean", value)
+	}
+	return value, nil
+}
+
+func (c *Coercer) coerceTime(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		switch strings.ToLower(s) {
+		case "infinity", "-infinity", "now", "today", "tomorrow", "yesterday", "epoch":
+			// Special inputs only PostgreSQL can resolve.
+			return s, nil
+		}
+		for _, layouts := range [][]string{c.timeLayouts, timestampLayouts} {
+			for _, layout := range layouts {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%q is not a recognized time", v)
+	case float64:
+		if !c.unixTimes {
+			return nil, errors.New("number in time column; Unix seconds need WithUnixTimes")
+		}
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	case bool:
+		return nil, errors.New("boolean in time column")
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !c.unixTimes {
+			return nil, errors.New("number in time column; Unix seconds need WithUnixTimes")
+		}
+		return time.Unix(rv.Int(), 0).UTC(), nil
+	}
+	return value, nil
+}
+
+func coerceUUID(value any) (any, error) {
+	var raw []byte
+	switch v := value.(type) {
+	case [16]byte:
+		raw = v[:]
+	case string:
+		if !isUUIDText(v) {
+			return nil, fmt.Errorf("%q is not a UUID", v)
+		}
+		digits := strings.NewReplacer("{", "", "}", "", "-", "").Replace(strings.TrimSpace(v))
+		raw, _ = hex.DecodeString(digits)
+	default:
+		return value, nil
+	}
+	h := hex.EncodeToString(raw)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32], nil
+}
+
+// arrayElementTypes maps an array's udt_name, without the leading underscore, to the
+// data_type of its elements.
+var arrayElementTypes = map[string]string{
+	"int2":        "smallint",
+	"int4":        "integer",
+	"int8":        "bigint",
+	"float4":      "real",
+	"float8":      "double precision",
+	"numeric":     "numeric",
+	"bool":        "boolean",
+	"text":        "text",
+	"varchar":     "character varying",
+	"bpchar":      "character",
+	"uuid":        "uuid",
+	"date":        "date",
+	"timestamp":   "timestamp without time zone",
+	"timestamptz": "timestamp with time zone",
+	"json":        "json",
+	"jsonb":       "jsonb",
+}
+
+// coerceArray converts JSON array text or a Go slice into a PostgreSQL array literal with
+// coerced elements. Text that is already an array literal ({...}) is passed through.
+func (c *Coercer) coerceArray(col ColumnInfo, value any) (any, error) {
+	var elems []any
+	switch v := value.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		if !strings.HasPrefix(s, "[") {
+			return v, nil
+		}
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.UseNumber()
+		if err := dec.Decode(&elems); err != nil {
+			return nil, fmt.Errorf("%q is not a JSON array: %w", v, err)
+		}
+	case []any:
+		elems = v
+	default:
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return value, nil
+		}
+		elems = make([]any, rv.Len())
+		for i := range elems {
+			elems[i] = rv.Index(i).Interface()
+		}
+	}
+
+	udt := strings.TrimPrefix(col.UDTName, "_")
+	elemCol := ColumnInfo{Name: col.Name, DataType: arrayElementTypes[udt], UDTName: udt, Nullable: true}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, elem := range elems {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		converted, err := c.coerce(elemCol, elem)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		writeArrayElement(&b, converted)
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
+
+func writeArrayElement(b *strings.Builder, value any) {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		b.WriteString("NULL")
+		return
+	case bool:
+		text = strconv.FormatBool(v)
+	case time.Time:
+		text = v.Format(time.RFC3339Nano)
+	case string:
+		text = v
+	default:
+		text = fmt.Sprint(v)
+	}
+	b.WriteByte('"')
+	b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text))
+	b.WriteByte('"')
+}
+
+func coerceJSON(value any) (any, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("encode JSON: %w", err)
+	}
+	return string(encoded), nil
+}
+
+func coerceText(value any) any {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(value)
+	}
+	return value
+}
+
+// CoercingUpserter converts every call's rows with a Coercer built from the table's
+// introspected columns and passes the converted copies on, so strategies receive typed
+// values instead of raw text. Values that do not convert fail the call with a *ValidationError.
+type CoercingUpserter struct {
+	upserter    Upserter
+	columns     *columnCache
+	timeLayouts []string
+	unixTimes   bool
+}
+
+func NewCoercingUpserter(upserter Upserter, db *sql.DB) *CoercingUpserter {
+	return &CoercingUpserter{upserter: upserter, columns: newColumnCache(db)}
+}
+
+// WithTimeLayouts returns a shallow copy whose coercers try layouts first; see Coercer.WithTimeLayouts.
+func (c *CoercingUpserter) WithTimeLayouts(layouts ...string) *CoercingUpserter {
+	clone := *c
+	clone.timeLayouts = layouts
+	return &clone
+}
+
+// WithUnixTimes returns a shallow copy whose coercers read numbers in time columns as Unix
+// seconds; see Coercer.WithUnixTimes.
+func (c *CoercingUpserter) WithUnixTimes() *CoercingUpserter {
+	clone := *c
+	clone.unixTimes = true
+	return &clone
+}
+
+func (c *CoercingUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	if len(rows) > 0 {
+		info, err := c.columns.get(ctx, table)
+		if err != nil {
+			return err
+		}
+		coercer := NewCoercer(info).WithTimeLayouts(c.timeLayouts...)
+		if c.unixTimes {
+			coercer = coercer.WithUnixTimes()
+		}
+		if rows, err = coercer.CoerceRows(columns, rows); err != nil {
+			return err
+		}
+	}
+	return c.upserter.Upsert(ctx, table, columns, rows, uniqueKeys)
+}
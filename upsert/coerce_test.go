@@ -0,0 +1,162 @@
+package upsert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var coerceColumns = []ColumnInfo{
+	{Name: "id", DataType: "bigint", UDTName: "int8"},
+	{Name: "qty", DataType: "smallint", UDTName: "int2"},
+	{Name: "price", DataType: "numeric", UDTName: "numeric"},
+	{Name: "score", DataType: "double precision", UDTName: "float8"},
+	{Name: "active", DataType: "boolean", UDTName: "bool"},
+	{Name: "seen_at", DataType: "timestamp with time zone", UDTName: "timestamptz"},
+	{Name: "ref", DataType: "uuid", UDTName: "uuid"},
+	{Name: "tags", DataType: "ARRAY", UDTName: "_text"},
+	{Name: "ids", DataType: "ARRAY", UDTName: "_int8"},
+	{Name: "doc", DataType: "jsonb", UDTName: "jsonb"},
+	{Name: "name", DataType: "text", UDTName: "text"},
+}
+
+func TestCoercerCoerce(t *testing.T) {
+	tests := []struct {
+		name   string
+		column string
+		value  any
+		want   any
+		err    bool
+	}{
+		{name: "intFromString", column: "id", value: " 42 ", want: int64(42)},
+		{name: "intFromNumber", column: "id", value: json.Number("1e3"), want: int64(1000)},
+		{name: "intFromFloat", column: "id", value: 7.0, want: int64(7)},
+		{name: "intFractional", column: "id", value: 7.5, err: true},
+		{name: "intAbove2To53Decimal", column: "id", value: "9007199254740993.0", want: int64(9007199254740993)},
+		{name: "intAbove2To53Exponent", column: "id", value: json.Number("9.007199254740993e15"), want: int64(9007199254740993)},
+		{name: "intAbove2To53Fraction", column: "id", value: "9007199254740993.5", err: true},
+		{name: "intOutOfRange", column: "id", value: "9.3e18", err: true},
+		{name: "intHugeExponent", column: "id", value: "1e1000000000", err: true},
+		{name: "intRatio", column: "id", value: "4/2", err: true},
+		{name: "intText", column: "id", value: "abc", err: true},
+		{name: "smallintRange", column: "qty", value: "40000", err: true},
+		{name: "decimalExact", column: "price", value: json.Number("12345678901234567890.01"), want: "12345678901234567890.01"},
+		{name: "decimalFromFloat", column: "price", value: 0.1, want: "0.1"},
+		{name: "decimalText", column: "price", value: "1,5", err: true},
+		{name: "float", column: "score", value: "2.5", want: 2.5},
+		{name: "boolWord", column: "active", value: "Yes", want: true},
+		{name: "boolNumber", column: "active", value: float64(0), want: false},
+		{name: "boolInvalid", column: "active", value: "maybe", err: true},
+		{name: "timeISO", column: "seen_at", value: "2024-01-02T03:04:05Z", want: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{name: "timeNumber", column: "seen_at", value: float64(1704164645), err: true},
+		{name: "timeSpecial", column: "seen_at", value: "infinity", want: "infinity"},
+		{name: "timeInvalid", column: "seen_at", value: "02/01/2024", err: true},
+		{name: "uuid", column: "ref", value: "{A0EEBC999C0B4EF8BB6D6BB9BD380A11}", want: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"},
+		{name: "uuidInvalid", column: "ref", value: "a0eebc99", err: true},
+		{name: "arrayFromJSON", column: "tags", value: `["a", "b \"c\"", null]`, want: `{"a","b \"c\"",NULL}`},
+		{name: "arrayFromSlice", column: "ids", value: []string{"1", "2"}, want: `{"1","2"}`},
+		{name: "arrayLiteral", column: "ids", value: "{1,2}", want: "{1,2}"},
+		{name: "arrayBadElement", column: "ids", value: []any{"x"}, err: true},
+		{name: "jsonFromMap", column: "doc", value: map[string]any{"a": 1}, want: `{"a":1}`},
+		{name: "textFromNumber", column: "name", value: json.Number("0012"), want: "0012"},
+		{name: "textFromFloat", column: "name", value: 1.5, want: "1.5"},
+		{name: "null", column: "id", value: nil, want: nil},
+		{name: "unknownColumn", column: "other", value: "x", want: "x"},
+	}
+
+	coercer := NewCoercer(coerceColumns)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := coercer.Coerce(tc.column, tc.value)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("Coerce(%q, %#v) = %#v, want error", tc.column, tc.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Coerce(%q, %#v): %v", tc.column, tc.value, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Coerce(%q, %#v) = %#v, want %#v", tc.column, tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCoercerWithTimeLayouts(t *testing.T) {
+	coercer := NewCoercer(coerceColumns).WithTimeLayouts("02/01/2006")
+	got, err := coercer.Coerce("seen_at", "02/01/2024")
+	if err != nil {
+		t.Fatalf("Coerce: %v", err)
+	}
+	if want := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC); !got.(time.Time).Equal(want) {
+		t.Fatalf("Coerce() = %v, want %v", got, want)
+	}
+}
+
+func TestCoercerWithUnixTimes(t *testing.T) {
+	coercer := NewCoercer(coerceColumns).WithUnixTimes()
+	want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, value := range []any{float64(1704164645), int64(1704164645)} {
+		got, err := coercer.Coerce("seen_at", value)
+		if err != nil {
+			t.Fatalf("Coerce(%#v): %v", value, err)
+		}
+		if !got.(time.Time).Equal(want) {
+			t.Fatalf("Coerce(%#v) = %v, want %v", value, got, want)
+		}
+	}
+	if _, err := NewCoercer(coerceColumns).Coerce("seen_at", int64(1704164645)); err == nil {
+		t.Fatal("expected error for integer time without WithUnixTimes, got nil")
+	}
+}
+
+func TestCoercerCoerceRows(t *testing.T) {
+	rows := [][]any{{"1", "yes"}, {"x", "maybe"}}
+	_, err := NewCoercer(coerceColumns).CoerceRows([]string{"id", "active"}, rows)
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("CoerceRows() = %v, want *ValidationError", err)
+	}
+	if len(verr.Violations) != 2 || verr.Violations[0].Row != 1 || verr.Violations[1].Column != 1 {
+		t.Fatalf("violations = %+v, want both values of row 1", verr.Violations)
+	}
+	if rows[0][0] != "1" {
+		t.Fatalf("CoerceRows modified its input: %v", rows[0])
+	}
+}
+
+func TestCoercingUpserterUpsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(introspectColumnsQuery)).
+		WithArgs("users", "").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "udt_name", "nullable", "max_length", "precision", "scale"}).
+			AddRow("id", "bigint", "int8", false, 0, 64, 0).
+			AddRow("active", "boolean", "bool", true, 0, 0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id", "active") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "active" = EXCLUDED."active"`)).
+		WithArgs(int64(1), true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	upserter := NewCoercingUpserter(NewHashIndexedUpserter(db), db)
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "active"}, [][]any{{"1", "t"}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package upsert
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Dialect captures the SQL differences between the databases the strategies target.
+type Dialect interface {
+	Name() string
+	// Placeholder returns the bind parameter for the n-th (1-based) argument.
+	Placeholder(n int) string
+	// QuoteIdentifier quotes a single identifier, escaping embedded quote characters. It
+	// fails only for names the database cannot hold, such as ones over its length limit.
+	QuoteIdentifier(name string) (string, error)
+	// UpsertClause returns the conflict handling appended to a multi-row INSERT.
+	// quotedUpdateColumns lists the non-key columns to overwrite and may be empty.
+	UpsertClause(quotedKeys, quotedUpdateColumns []string) string
+	// ReturningInserted returns a clause that makes the upsert yield one boolean per
+	// written row, true for inserts, or "" if the database cannot report it.
+	ReturningInserted() string
+	// CreateUniqueIndex returns DDL creating a unique index over quotedKeys.
+	CreateUniqueIndex(indexIdent, tableIdent string, quotedKeys []string) string
+	// IsIndexExists reports whether err from CreateUniqueIndex only means the index is already there.
+	IsIndexExists(err error) bool
+	// MaxPlaceholders is the largest number of bind parameters one statement may carry.
+	MaxPlaceholders() int
+	// UpdateFrom returns an UPDATE of tableIdent that sets quotedUpdateColumns from
+	// rowCount rows of bind parameters covering quotedColumns, matched on quotedKeys, or
+	// "" if the database has no UPDATE ... FROM.
+	UpdateFrom(tableIdent string, quotedColumns, quotedUpdateColumns, quotedKeys []string, rowCount int) string
+	// ExistingRows returns a query yielding the 0-based ordinal of each of rowCount rows
+	// of bind parameters over quotedKeys whose key is already in tableIdent. The database
+	// compares the keys in the column types, so "1.0" matches a numeric 1.00.
+	ExistingRows(tableIdent string, quotedKeys []string, rowCount int) string
+}
+
+var (
+	// Postgres targets PostgreSQL: $n placeholders, double-quoted identifiers and ON CONFLICT.
+	Postgres Dialect = postgresDialect{}
+	// MySQL targets MySQL and MariaDB: ? placeholders, backticks and ON DUPLICATE KEY UPDATE.
+	// ON DUPLICATE KEY UPDATE fires on a conflict with any unique index of the table, not
+	// only the one over the requested unique keys.
+	MySQL Dialect = mysqlDialect{}
+	// SQLite targets SQLite 3.24 or newer: ? placeholders, double-quoted identifiers and ON CONFLICT.
+	SQLite Dialect = sqliteDialect{}
+)
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+func (postgresDialect) QuoteIdentifier(name string) (string, error) {
+	if len(name) > maxIdentifierBytes {
+		return "", fmt.Errorf("identifier %q is longer than %d bytes", name, maxIdentifierBytes)
+	}
+	return quoteWith(name, `"`)
+}
+
+func (postgresDialect) UpsertClause(quotedKeys, quotedUpdateColumns []string) string {
+	if len(quotedUpdateColumns) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(quotedKeys, ", "))
+	}
+	setClauses := make([]string, len(quotedUpdateColumns))
+	for i, col := range quotedUpdateColumns {
+		setClauses[i] = fmt.Sprintf("%s = EXCLUDED.%s", col, col)
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quotedKeys, ", "), strings.Join(setClauses, ", "))
+}
+
+func (postgresDialect) ReturningInserted() string { return "RETURNING (xmax = 0)" }
+
+func (postgresDialect) CreateUniqueIndex(indexIdent, tableIdent string, quotedKeys []string) string {
+	return fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)", indexIdent, tableIdent, strings.Join(quotedKeys, ", "))
+}
+
+func (postgresDialect) IsIndexExists(error) bool { return false }
+
+func (postgresDialect) MaxPlaceholders() int { return 65535 }
+
+// UpdateFrom feeds the rows through UNION ALL SELECT leaves after an empty SELECT from the
+// table, so the untyped parameters take the table's column types. A VALUES list would
+// resolve them as text first.
+func (d postgresDialect) UpdateFrom(tableIdent string, quotedColumns, quotedUpdateColumns, quotedKeys []string, rowCount int) string {
+	var source strings.Builder
+	fmt.Fprintf(&source, "SELECT %s FROM %s WHERE false", strings.Join(quotedColumns, ", "), tableIdent)
+	for _, row := range placeholderRows(d, len(quotedColumns), rowCount) {
+		fmt.Fprintf(&source, " UNION ALL SELECT %s", row)
+	}
+	return updateFrom(tableIdent, source.String(), quotedUpdateColumns, quotedKeys)
+}
+
+func (d postgresDialect) ExistingRows(tableIdent string, quotedKeys []string, rowCount int) string {
+	return existingRows(tableIdent, unionKeySource(d, tableIdent, quotedKeys, rowCount), quotedKeys)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) Placeholder(int) string { return "?" }
+
+func (mysqlDialect) QuoteIdentifier(name string) (string, error) {
+	if utf8.RuneCountInString(name) > 64 {
+		return "", fmt.Errorf("identifier %q is longer than 64 characters", name)
+	}
+	return quoteWith(name, "`")
+}
+
+func (mysqlDialect) UpsertClause(quotedKeys, quotedUpdateColumns []string) string {
+	if len(quotedUpdateColumns) == 0 {
+		// A self-assignment keeps the existing row, like DO NOTHING.
+		return fmt.Sprintf("ON DUPLICATE KEY UPDATE %s = %s", quotedKeys[0], quotedKeys[0])
+	}
+	setClauses := make([]string, len(quotedUpdateColumns))
+	for i, col := range quotedUpdateColumns {
+		setClauses[i] = fmt.Sprintf("%s = VALUES(%s)", col, col)
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(setClauses, ", ")
+}
+
+func (mysqlDialect) ReturningInserted() string { return "" }
+
+// CreateUniqueIndex omits IF NOT EXISTS, which MySQL does not support for indexes.
+func (mysqlDialect) CreateUniqueIndex(indexIdent, tableIdent string, quotedKeys []string) string {
+	return fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", indexIdent, tableIdent, strings.Join(quotedKeys, ", "))
+}
+
+// IsIndexExists matches error 1061 (ER_DUP_KEYNAME) without importing a MySQL driver.
+func (mysqlDialect) IsIndexExists(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "Error 1061") || strings.Contains(err.Error(), "Duplicate key name"))
+}
+
+func (mysqlDialect) MaxPlaceholders() int { return 65535 }
+
+func (mysqlDialect) UpdateFrom(string, []string, []string, []string, int) string { return "" }
+
+func (d mysqlDialect) ExistingRows(tableIdent string, quotedKeys []string, rowCount int) string {
+	return existingRows(tableIdent, unionKeySource(d, tableIdent, quotedKeys, rowCount), quotedKeys)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) Placeholder(int) string { return "?" }
+
+func (sqliteDialect) QuoteIdentifier(name string) (string, error) { return quoteWith(name, `"`) }
+
+func (sqliteDialect) UpsertClause(quotedKeys, quotedUpdateColumns []string) string {
+	if len(quotedUpdateColumns) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(quotedKeys, ", "))
+	}
+	setClauses := make([]string, len(quotedUpdateColumns))
+	for i, col := range quotedUpdateColumns {
+		setClauses[i] = fmt.Sprintf("%s = excluded.%s", col, col)
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quotedKeys, ", "), strings.Join(setClauses, ", "))
+}
+
+// ReturningInserted returns "": SQLite has RETURNING but nothing like xmax to tell an
+// insert from an update.
+func (sqliteDialect) ReturningInserted() string { return "" }
+
+func (sqliteDialect) CreateUniqueIndex(indexIdent, tableIdent string, quotedKeys []string) string {
+	return fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)", indexIdent, tableIdent, strings.Join(quotedKeys, ", "))
+}
+
+func (sqliteDialect) IsIndexExists(error) bool { return false }
+
+// MaxPlaceholders is SQLITE_MAX_VARIABLE_NUMBER of SQLite 3.32 and newer.
+func (sqliteDialect) MaxPlaceholders() int { return 32766 }
+
+// UpdateFrom needs SQLite 3.33 or newer. The rows form one VALUES term after an empty
+// SELECT naming the columns, keeping clear of the 500-term compound SELECT limit.
+func (d sqliteDialect) UpdateFrom(tableIdent string, quotedColumns, quotedUpdateColumns, quotedKeys []string, rowCount int) string {
+	source := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE false UNION ALL VALUES (%s)",
+		strings.Join(quotedColumns, ", "),
+		tableIdent,
+		strings.Join(placeholderRows(d, len(quotedColumns), rowCount), "), ("),
+	)
+	return updateFrom(tableIdent, source, quotedUpdateColumns, quotedKeys)
+}
+
+// ExistingRows puts the rows in one VALUES term, like UpdateFrom.
+func (d sqliteDialect) ExistingRows(tableIdent string, quotedKeys []string, rowCount int) string {
+	rows := placeholderRows(d, len(quotedKeys), rowCount)
+	for i := range rows {
+		rows[i] += fmt.Sprintf(", %d", i)
+	}
+	source := fmt.Sprintf("SELECT %s, 0 AS ord FROM %s WHERE false UNION ALL VALUES (%s)", strings.Join(quotedKeys, ", "), tableIdent, strings.Join(rows, "), ("))
+	return existingRows(tableIdent, source, quotedKeys)
+}
+
+// unionKeySource feeds the key rows, each followed by its ordinal, through UNION ALL
+// SELECT leaves after an empty SELECT from the table, so the parameters take the key
+// column types.
+func unionKeySource(d Dialect, tableIdent string, quotedKeys []string, rowCount int) string {
+	var source strings.Builder
+	fmt.Fprintf(&source, "SELECT %s, 0 AS ord FROM %s WHERE false", strings.Join(quotedKeys, ", "), tableIdent)
+	for i, row := range placeholderRows(d, len(quotedKeys), rowCount) {
+		fmt.Fprintf(&source, " UNION ALL SELECT %s, %d", row, i)
+	}
+	return source.String()
+}
+
+// existingRows selects the ordinals of source rows whose keys exist in tableIdent.
+func existingRows(tableIdent, source string, quotedKeys []string) string {
+	joinClauses := make([]string, len(quotedKeys))
+	for i, key := range quotedKeys {
+		joinClauses[i] = fmt.Sprintf("%s.%s = v.%s", tableIdent, key, key)
+	}
+	return fmt.Sprintf("SELECT v.ord FROM (%s) AS v WHERE EXISTS (SELECT 1 FROM %s WHERE %s)", source, tableIdent, strings.Join(joinClauses, " AND "))
+}
+
+// updateFrom builds the UPDATE ... FROM shared by PostgreSQL and SQLite.
+func updateFrom(tableIdent, source string, quotedUpdateColumns, quotedKeys []string) string {
+	setClauses := make([]string, len(quotedUpdateColumns))
+	for i, col := range quotedUpdateColumns {
+		setClauses[i] = fmt.Sprintf("%s = v.%s", col, col)
+	}
+	joinClauses := make([]string, len(quotedKeys))
+	for i, key := range quotedKeys {
+		joinClauses[i] = fmt.Sprintf("%s.%s = v.%s", tableIdent, key, key)
+	}
+	return fmt.Sprintf("UPDATE %s SET %s FROM (%s) AS v WHERE %s", tableIdent, strings.Join(setClauses, ", "), source, strings.Join(joinClauses, " AND "))
+}
+
+// placeholderRows returns rowCount comma-separated placeholder lists of width columns,
+// numbered consecutively from 1.
+func placeholderRows(d Dialect, columns, rowCount int) []string {
+	rows := make([]string, rowCount)
+	argIdx := 1
+	for i := range rows {
+		placeholders := make([]string, columns)
+		for j := range placeholders {
+			placeholders[j] = d.Placeholder(argIdx)
+			argIdx++
+		}
+		rows[i] = strings.Join(placeholders, ", ")
+	}
+	return rows
+}
@@ -0,0 +1,165 @@
+package upsert
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDialectUpsertClause(t *testing.T) {
+	tests := []struct {
+		name          string
+		dialect       Dialect
+		updateColumns []string
+		want          string
+	}{
+		{"postgres update", Postgres, []string{`"name"`}, `ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`},
+		{"postgres nothing", Postgres, nil, `ON CONFLICT ("id") DO NOTHING`},
+		{"mysql update", MySQL, []string{"`name`", "`email`"}, "ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `email` = VALUES(`email`)"},
+		{"mysql nothing", MySQL, nil, "ON DUPLICATE KEY UPDATE `id` = `id`"},
+		{"sqlite update", SQLite, []string{`"name"`}, `ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name"`},
+		{"sqlite nothing", SQLite, nil, `ON CONFLICT ("id") DO NOTHING`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := []string{`"id"`}
+			if tt.dialect == MySQL {
+				keys = []string{"`id`"}
+			}
+			if got := tt.dialect.UpsertClause(keys, tt.updateColumns); got != tt.want {
+				t.Fatalf("UpsertClause() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMySQLQuoteIdentifier(t *testing.T) {
+	got, err := MySQL.QuoteIdentifier("users")
+	if err != nil {
+		t.Fatalf("QuoteIdentifier: %v", err)
+	}
+	if got != "`users`" {
+		t.Fatalf("QuoteIdentifier() = %q, want %q", got, "`users`")
+	}
+	got, err = MySQL.QuoteIdentifier("users`; DROP TABLE x")
+	if err != nil {
+		t.Fatalf("QuoteIdentifier: %v", err)
+	}
+	if want := "`users``; DROP TABLE x`"; got != want {
+		t.Fatalf("QuoteIdentifier() = %q, want %q", got, want)
+	}
+}
+
+func TestHashIndexedUpserterUpsert_MySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewHashIndexedUpserter(db, WithDialect(MySQL))
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE UNIQUE INDEX `idx_de7ebd7b26552dfc` ON `users` (`id`)")).
+		WillReturnError(errors.New("Error 1061 (42000): Duplicate key name 'idx_de7ebd7b26552dfc'"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`id`, `name`) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)")).
+		WithArgs(int64(1), "John", int64(2), "Jane").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	var stats Stats
+	ctx := WithStats(context.Background(), &stats)
+	rows := [][]any{{int64(1), "John"}, {int64(2), "Jane"}}
+	if err := upserter.Upsert(ctx, "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if stats.Rows() != 2 || stats.Inserted() != 0 || stats.Updated() != 0 {
+		t.Fatalf("stats = rows %d inserted %d updated %d, want 2/0/0", stats.Rows(), stats.Inserted(), stats.Updated())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestHashIndexedUpserterUpsert_MySQLIndexError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewHashIndexedUpserter(db, WithDialect(MySQL))
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE UNIQUE INDEX `idx_de7ebd7b26552dfc` ON `users` (`id`)")).
+		WillReturnError(errors.New("Error 1146 (42S02): Table 'app.users' doesn't exist"))
+
+	err = upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{int64(1)}}, []string{"id"})
+	if err == nil {
+		t.Fatal("expected create index error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestNaiveUpserterUpsert_MySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewNaiveUpserter(db, WithDialect(MySQL))
+
+	checkQuery := regexp.QuoteMeta("SELECT 1 FROM `users` WHERE `id` = ? LIMIT 1")
+	mock.ExpectBegin()
+	mock.ExpectQuery(checkQuery).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `id` = ?, `name` = ? WHERE `id` = ?")).
+		WithArgs(int64(1), "John", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(checkQuery).WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"}))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`id`, `name`) VALUES (?, ?)")).
+		WithArgs(int64(2), "Jane").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	rows := [][]any{{int64(1), "John"}, {int64(2), "Jane"}}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestBatchedHashIndexedUpserterUpsert_MySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewBatchedHashIndexedUpserter(db, WithDialect(MySQL)).(*BatchedHashIndexedUpserter).WithBatchSize(1)
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE UNIQUE INDEX `idx_de7ebd7b26552dfc` ON `users` (`id`)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`id`) VALUES (?) ON DUPLICATE KEY UPDATE `id` = `id`")).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE UNIQUE INDEX `idx_de7ebd7b26552dfc` ON `users` (`id`)")).
+		WillReturnError(errors.New("Error 1061 (42000): Duplicate key name 'idx_de7ebd7b26552dfc'"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`id`) VALUES (?) ON DUPLICATE KEY UPDATE `id` = `id`")).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{int64(1)}, {int64(2)}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
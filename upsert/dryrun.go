@@ -0,0 +1,357 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// DryRun records the statements a strategy would send instead of running them. Pass
+// DB() to any database/sql strategy in place of the real database, call Upsert, then
+// read the Plan:
+//
+//	rec := upsert.NewDryRun()
+//	err := upsert.NewBatchedHashIndexedUpserter(rec.DB()).Upsert(ctx, "users", columns, rows, keys)
+//	plan := rec.Plan()
+//	err = plan.Explain(ctx, prod, upsert.Postgres)
+//	fmt.Print(plan)
+//
+// Every statement succeeds and affects no rows. Queries return no rows unless ReadFrom
+// names a database to answer the read-only ones; without it the existence checks of the
+// naive strategies find nothing, so their plans insert every row and never update. The
+// statements the other strategies send do not depend on the table contents. A DryRun is
+// safe for concurrent use.
+type DryRun struct {
+	db    *sql.DB
+	reads *sql.DB
+
+	mu         sync.Mutex
+	statements []PlannedStatement
+}
+
+// PlannedStatement is one statement recorded by a DryRun.
+type PlannedStatement struct {
+	SQL  string
+	Args []any
+	// InTx reports whether the statement runs inside a transaction. BEGIN, COMMIT and
+	// ROLLBACK are recorded as statements of their own.
+	InTx bool
+	// Explain holds the output of EXPLAIN, one line per result row, after Plan.Explain.
+	Explain []string
+	// ExplainErr is why EXPLAIN failed for this statement, if it did.
+	ExplainErr error
+}
+
+// Plan lists the statements of a dry run in the order they would have been sent.
+type Plan struct {
+	Statements []PlannedStatement
+}
+
+// NewDryRun returns a DryRun with an empty plan.
+func NewDryRun() *DryRun {
+	d := &DryRun{}
+	d.db = sql.OpenDB(dryRunConnector{d})
+	return d
+}
+
+// ReadFrom sends the plain SELECTs of the strategies, such as the existence checks of
+// the naive strategies and the table inspection of AutoUpserter, to db and returns their
+// rows, so the plan updates the rows that exist. These reads are not recorded; advisory
+// locks and all writes still are. Call it before the first statement.
+func (d *DryRun) ReadFrom(db *sql.DB) *DryRun {
+	d.reads = db
+	return d
+}
+
+// DB returns the recording database. It needs no Close.
+func (d *DryRun) DB() *sql.DB { return d.db }
+
+// Plan returns a copy of the statements recorded so far.
+func (d *DryRun) Plan() *Plan {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &Plan{Statements: append([]PlannedStatement(nil), d.statements...)}
+}
+
+// Reset discards the recorded statements.
+func (d *DryRun) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = nil
+}
+
+func (d *DryRun) record(query string, args []driver.NamedValue, inTx bool) {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, PlannedStatement{SQL: query, Args: values, InTx: inTx})
+}
+
+// Explain runs EXPLAIN, without ANALYZE, on every INSERT, UPDATE, DELETE and SELECT of
+// the plan against db and stores the output on the statement. EXPLAIN only plans a
+// statement, so nothing is written. A statement EXPLAIN rejects, such as an INSERT ...
+// ON CONFLICT whose unique index an earlier statement of the plan would have created,
+// keeps the error in ExplainErr; Explain itself only fails when ctx is done.
+func (p *Plan) Explain(ctx context.Context, db *sql.DB, d Dialect) error {
+	prefix := "EXPLAIN "
+	if d == SQLite {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+	for i := range p.Statements {
+		stmt := &p.Statements[i]
+		if !isExplainable(stmt.SQL) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stmt.Explain, stmt.ExplainErr = explain(ctx, db, prefix+stmt.SQL, stmt.Args)
+	}
+	return ctx.Err()
+}
+
+func isExplainable(query string) bool {
+	verb, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	switch strings.ToUpper(verb) {
+	case "INSERT", "UPDATE", "DELETE", "SELECT", "WITH":
+		return true
+	}
+	return false
+}
+
+func explain(ctx context.Context, db *sql.DB, query string, args []any) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range dest {
+		dest[i] = &values[i]
+	}
+	var lines []string
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			fields[i] = fmt.Sprint(v)
+		}
+		lines = append(lines, strings.Join(fields, "\t"))
+	}
+	return lines, rows.Err()
+}
+
+// maxPlanArgs caps the arguments String prints per statement.
+const maxPlanArgs = 10
+
+// String formats the plan for review: each statement with up to ten of its arguments
+// and its EXPLAIN output.
+func (p *Plan) String() string {
+	var b strings.Builder
+	for i, stmt := range p.Statements {
+		indent := ""
+		if stmt.InTx && !isTxControl(stmt.SQL) {
+			indent = "  "
+		}
+		fmt.Fprintf(&b, "%d. %s%s\n", i+1, indent, stmt.SQL)
+		if len(stmt.Args) > 0 {
+			shown := stmt.Args[:min(len(stmt.Args), maxPlanArgs)]
+			fmt.Fprintf(&b, "   %sargs: %v", indent, shown)
+			if n := len(stmt.Args) - len(shown); n > 0 {
+				fmt.Fprintf(&b, " ... (%d more)", n)
+			}
+			b.WriteString("\n")
+		}
+		if stmt.ExplainErr != nil {
+			fmt.Fprintf(&b, "   %sexplain failed: %v\n", indent, stmt.ExplainErr)
+		}
+		for _, line := range stmt.Explain {
+			fmt.Fprintf(&b, "   %s| %s\n", indent, line)
+		}
+	}
+	return b.String()
+}
+
+func isTxControl(query string) bool {
+	return query == "BEGIN" || query == "COMMIT" || query == "ROLLBACK"
+}
+
+// dryRunConnector hands out connections that record into one DryRun.
+type dryRunConnector struct{ d *DryRun }
+
+func (c dryRunConnector) Connect(context.Context) (driver.Conn, error) {
+	return &dryRunConn{d: c.d}, nil
+}
+
+func (c dryRunConnector) Driver() driver.Driver { return dryRunDriver{} }
+
+type dryRunDriver struct{}
+
+func (dryRunDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("dry run connections come from NewDryRun")
+}
+
+type dryRunConn struct {
+	d    *DryRun
+	inTx bool
+}
+
+func (c *dryRunConn) Prepare(query string) (driver.Stmt, error) {
+	return &dryRunStmt{conn: c, query: query}, nil
+}
+
+func (c *dryRunConn) Close() error { return nil }
+
+func (c *dryRunConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *dryRunConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.d.record("BEGIN", nil, true)
+	c.inTx = true
+	return dryRunTx{c}, nil
+}
+
+// CheckNamedValue keeps arguments as given, so the plan shows what the strategy passed
+// rather than its driver encoding.
+func (c *dryRunConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c *dryRunConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.record(query, args, c.inTx)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *dryRunConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.d.reads != nil && isReadOnly(query) {
+		return readRows(ctx, c.d.reads, query, args)
+	}
+	c.d.record(query, args, c.inTx)
+	return &dryRunRows{}, nil
+}
+
+// isReadOnly reports whether query is a SELECT that neither locks nor writes.
+func isReadOnly(query string) bool {
+	verb, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	return strings.EqualFold(verb, "SELECT") && !strings.Contains(query, "pg_advisory") && !strings.Contains(strings.ToUpper(query), " FOR ")
+}
+
+// readRows runs query on db and buffers its rows, so the connection is returned before
+// the strategy goes on.
+func readRows(ctx context.Context, db *sql.DB, query string, args []driver.NamedValue) (driver.Rows, error) {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	rows, err := db.QueryContext(ctx, query, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	buffered := &dryRunRows{columns: columns}
+	for rows.Next() {
+		row := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range dest {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			values[i] = v
+		}
+		buffered.rows = append(buffered.rows, values)
+	}
+	return buffered, rows.Err()
+}
+
+type dryRunTx struct{ c *dryRunConn }
+
+func (t dryRunTx) Commit() error {
+	t.c.inTx = false
+	t.c.d.record("COMMIT", nil, true)
+	return nil
+}
+
+func (t dryRunTx) Rollback() error {
+	t.c.inTx = false
+	t.c.d.record("ROLLBACK", nil, true)
+	return nil
+}
+
+type dryRunStmt struct {
+	conn  *dryRunConn
+	query string
+}
+
+func (s *dryRunStmt) Close() error { return nil }
+
+// NumInput returns -1 so database/sql leaves argument counting to the statement.
+func (s *dryRunStmt) NumInput() int { return -1 }
+
+func (s *dryRunStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *dryRunStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *dryRunStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *dryRunStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func (s *dryRunStmt) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+// dryRunRows returns buffered rows, or none.
+type dryRunRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *dryRunRows) Columns() []string { return r.columns }
+func (r *dryRunRows) Close() error      { return nil }
+
+func (r *dryRunRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
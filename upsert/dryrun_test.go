@@ -0,0 +1,146 @@
+package upsert
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDryRun_RecordsBatchedPlan(t *testing.T) {
+	rec := NewDryRun()
+	upserter := NewBatchedHashIndexedUpserter(rec.DB()).(*BatchedHashIndexedUpserter).WithBatchSize(2)
+
+	rows := [][]any{{int64(1), "John"}, {int64(2), "Jane"}, {int64(3), "Jim"}}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	var sqls []string
+	for _, stmt := range rec.Plan().Statements {
+		sqls = append(sqls, stmt.SQL)
+	}
+	want := []string{
+		`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`,
+		`INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`,
+		`INSERT INTO "users" ("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`,
+	}
+	if !reflect.DeepEqual(sqls, want) {
+		t.Fatalf("statements = %q, want %q", sqls, want)
+	}
+	if got := rec.Plan().Statements[1].Args; !reflect.DeepEqual(got, []any{int64(1), "John", int64(2), "Jane"}) {
+		t.Fatalf("batch args = %v", got)
+	}
+
+	rec.Reset()
+	if n := len(rec.Plan().Statements); n != 0 {
+		t.Fatalf("after Reset: %d statements", n)
+	}
+}
+
+func TestDryRun_RecordsNaiveTransaction(t *testing.T) {
+	rec := NewDryRun()
+	upserter := NewNaiveUpserter(rec.DB())
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, [][]any{{int64(1), "John"}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	plan := rec.Plan()
+	var sqls []string
+	for _, stmt := range plan.Statements {
+		sqls = append(sqls, stmt.SQL)
+	}
+	// The existence check finds nothing in a dry run, so the row is inserted.
+	want := []string{
+		"BEGIN",
+		`SELECT 1 FROM "users" WHERE "id" = $1 LIMIT 1`,
+		`INSERT INTO "users" ("id", "name") VALUES ($1, $2)`,
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(sqls, want) {
+		t.Fatalf("statements = %q, want %q", sqls, want)
+	}
+	if !plan.Statements[1].InTx {
+		t.Fatal("existence check not marked as inside the transaction")
+	}
+
+	report := plan.String()
+	for _, line := range []string{
+		"1. BEGIN\n",
+		"2.   SELECT 1 FROM \"users\" WHERE \"id\" = $1 LIMIT 1\n     args: [1]\n",
+		"4. COMMIT\n",
+	} {
+		if !strings.Contains(report, line) {
+			t.Fatalf("report missing %q:\n%s", line, report)
+		}
+	}
+}
+
+func TestDryRun_ReadFrom(t *testing.T) {
+	db := openSQLite(t, `CREATE TABLE users (id INTEGER NOT NULL, name TEXT); INSERT INTO users VALUES (1, 'John')`)
+
+	rec := NewDryRun().ReadFrom(db)
+	upserter := NewNaiveUpserter(rec.DB(), WithDialect(SQLite))
+	rows := [][]any{{int64(1), "Johnny"}, {int64(2), "Jane"}}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	var sqls []string
+	for _, stmt := range rec.Plan().Statements {
+		sqls = append(sqls, stmt.SQL)
+	}
+	// The existence checks read the real table and are not recorded: 1 exists, 2 does not.
+	want := []string{
+		"BEGIN",
+		`UPDATE "users" SET "id" = ?, "name" = ? WHERE "id" = ?`,
+		`INSERT INTO "users" ("id", "name") VALUES (?, ?)`,
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(sqls, want) {
+		t.Fatalf("statements = %q, want %q", sqls, want)
+	}
+	if got := queryRows(t, db, `SELECT id, name FROM users`); !reflect.DeepEqual(got, [][]any{{int64(1), "John"}}) {
+		t.Fatalf("rows after dry run = %v", got)
+	}
+}
+
+func TestPlanString_TruncatesArgs(t *testing.T) {
+	args := make([]any, 12)
+	for i := range args {
+		args[i] = i
+	}
+	plan := &Plan{Statements: []PlannedStatement{{SQL: "INSERT", Args: args}}}
+	if got, want := plan.String(), "1. INSERT\n   args: [0 1 2 3 4 5 6 7 8 9] ... (2 more)\n"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestPlanExplain_SQLite(t *testing.T) {
+	db := openSQLite(t, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`)
+
+	rec := NewDryRun()
+	upserter := NewHashIndexedUpserter(rec.DB(), WithDialect(SQLite))
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, [][]any{{int64(1), "John"}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	plan := rec.Plan()
+	if err := plan.Explain(context.Background(), db, SQLite); err != nil {
+		t.Fatalf("Explain: %v", err)
+	}
+	ddl, insert := plan.Statements[0], plan.Statements[1]
+	if ddl.Explain != nil || ddl.ExplainErr != nil {
+		t.Fatalf("DDL was explained: %v %v", ddl.Explain, ddl.ExplainErr)
+	}
+	if insert.ExplainErr != nil {
+		t.Fatalf("explain insert: %v", insert.ExplainErr)
+	}
+
+	// EXPLAIN only plans: the dry run must not have written anything.
+	if got := queryRows(t, db, `SELECT COUNT(*) FROM users`); !reflect.DeepEqual(got, [][]any{{int64(0)}}) {
+		t.Fatalf("rows after dry run = %v", got)
+	}
+}
@@ -5,18 +5,28 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type HashIndexedUpserter struct {
 	db *sql.DB
+	options
 }
 
-func NewHashIndexedUpserter(db *sql.DB) Upserter {
-	return &HashIndexedUpserter{db: db}
+func NewHashIndexedUpserter(db *sql.DB, opts ...Option) Upserter {
+	return &HashIndexedUpserter{db: db, options: newOptions(opts)}
 }
 
 func (h *HashIndexedUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	return h.instrument(ctx, "hash", table, columns, rows, false, func(ctx context.Context) error {
+		return h.upsert(ctx, table, columns, rows, uniqueKeys)
+	})
+}
+
+func (h *HashIndexedUpserter) upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
 	if len(columns) == 0 {
 		return errors.New("at least one column is required")
 	}
@@ -27,7 +37,7 @@ func (h *HashIndexedUpserter) Upsert(ctx context.Context, table string, columns
 		return nil
 	}
 
-	tableIdent, err := quoteIdentifier(table)
+	tableIdent, err := h.quoteTable(table)
 	if err != nil {
 		return fmt.Errorf("table: %w", err)
 	}
@@ -35,7 +45,7 @@ func (h *HashIndexedUpserter) Upsert(ctx context.Context, table string, columns
 	columnIndex := make(map[string]int, len(columns))
 	quotedColumns := make([]string, len(columns))
 	for i, col := range columns {
-		quoted, err := quoteIdentifier(col)
+		quoted, err := h.quote(col)
 		if err != nil {
 			return fmt.Errorf("column[%d]: %w", i, err)
 		}
@@ -48,7 +58,7 @@ func (h *HashIndexedUpserter) Upsert(ctx context.Context, table string, columns
 		if _, ok := columnIndex[key]; !ok {
 			return fmt.Errorf("unique key %q not found in columns", key)
 		}
-		quoted, err := quoteIdentifier(key)
+		quoted, err := h.quote(key)
 		if err != nil {
 			return fmt.Errorf("unique key %q: %w", key, err)
 		}
@@ -71,20 +81,16 @@ func (h *HashIndexedUpserter) Upsert(ctx context.Context, table string, columns
 		seenKeys[key] = idx
 	}
 
-	placeholders := make([]string, len(rows))
+	if n := len(rows) * len(columns); n > h.dialect.MaxPlaceholders() {
+		return fmt.Errorf("%d values exceed the %s limit of %d bind parameters per statement; use the batched strategy", n, h.dialect.Name(), h.dialect.MaxPlaceholders())
+	}
+
 	args := make([]any, 0, len(rows)*len(columns))
-	argIdx := 1
-	for i, row := range rows {
-		rowPlaceholders := make([]string, len(columns))
-		for j := range columns {
-			rowPlaceholders[j] = fmt.Sprintf("$%d", argIdx)
-			args = append(args, row[j])
-			argIdx++
-		}
-		placeholders[i] = fmt.Sprintf("(%s)", strings.Join(rowPlaceholders, ", "))
+	for _, row := range rows {
+		args = append(args, row...)
 	}
 
-	setClauses := make([]string, 0, len(columns))
+	updateColumns := make([]string, 0, len(columns))
 	uniqueSet := make(map[string]struct{}, len(uniqueKeys))
 	for _, key := range uniqueKeys {
 		uniqueSet[key] = struct{}{}
@@ -94,35 +100,76 @@ func (h *HashIndexedUpserter) Upsert(ctx context.Context, table string, columns
 			// Skip unique columns from SET clause to avoid redundant assignments.
 			continue
 		}
-		setClauses = append(setClauses, fmt.Sprintf("%s = EXCLUDED.%s", quotedColumns[i], quotedColumns[i]))
-	}
-
-	var query string
-	if len(setClauses) == 0 {
-		query = fmt.Sprintf(
-			"INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) DO NOTHING",
-			tableIdent,
-			strings.Join(quotedColumns, ", "),
-			strings.Join(placeholders, ", "),
-			strings.Join(quotedUniqueKeys, ", "),
-		)
-	} else {
-		query = fmt.Sprintf(
-			"INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) DO UPDATE SET %s",
-			tableIdent,
-			strings.Join(quotedColumns, ", "),
-			strings.Join(placeholders, ", "),
-			strings.Join(quotedUniqueKeys, ", "),
-			strings.Join(setClauses, ", "),
-		)
-	}
-
-	if _, err := h.db.ExecContext(ctx, query, args...); err != nil {
-		return fmt.Errorf("exec upsert: %w", err)
+		updateColumns = append(updateColumns, quotedColumns[i])
+	}
+
+	plan := upsertPlan{
+		dialect:          h.dialect,
+		tableIdent:       tableIdent,
+		quotedColumns:    quotedColumns,
+		quotedUniqueKeys: quotedUniqueKeys,
+		updateColumns:    updateColumns,
+	}
+	query := func() string { return plan.insertValues(len(rows)) }
+
+	stats := statsFromContext(ctx)
+	returning := h.dialect.ReturningInserted()
+	if stats == nil || returning == "" {
+		key := newStatementKey(h.db, table, columns, uniqueKeys, len(rows), "upsert")
+		stmt, err := h.prepare(ctx, key, query)
+		if err != nil {
+			return fmt.Errorf("prepare upsert: %w", err)
+		}
+		defer stmt.release()
+		if _, err := stmt.exec(ctx, h.db, nil, args...); err != nil {
+			return fmt.Errorf("exec upsert: %w", err)
+		}
+		if stats != nil {
+			stats.add(int64(len(rows)), 0, 0)
+		}
+		return nil
+	}
+
+	key := newStatementKey(h.db, table, columns, uniqueKeys, len(rows), "upsert returning")
+	inserted, updated, err := h.execCounting(ctx, key, func() string { return query() + " " + returning }, args)
+	if err != nil {
+		return err
 	}
+	stats.add(int64(len(rows)), inserted, updated)
 	return nil
 }
 
+// execCounting runs an upsert carrying the dialect's ReturningInserted clause and counts
+// inserted and updated rows. Rows skipped by DO NOTHING are not returned.
+func (h *HashIndexedUpserter) execCounting(ctx context.Context, key statementKey, query func() string, args []any) (inserted, updated int64, err error) {
+	stmt, err := h.prepare(ctx, key, query)
+	if err != nil {
+		return 0, 0, fmt.Errorf("prepare upsert: %w", err)
+	}
+	defer stmt.release()
+	result, err := stmt.queryRows(ctx, h.db, nil, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("exec upsert: %w", err)
+	}
+	defer result.Close()
+
+	for result.Next() {
+		var isInsert bool
+		if err := result.Scan(&isInsert); err != nil {
+			return 0, 0, fmt.Errorf("scan upsert result: %w", err)
+		}
+		if isInsert {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+	if err := result.Err(); err != nil {
+		return 0, 0, fmt.Errorf("exec upsert: %w", err)
+	}
+	return inserted, updated, nil
+}
+
 func compositeKey(row []any, uniqueKeys []string, columnIndex map[string]int) string {
 	var b strings.Builder
 	for i, key := range uniqueKeys {
@@ -135,20 +182,27 @@ func compositeKey(row []any, uniqueKeys []string, columnIndex map[string]int) st
 	return b.String()
 }
 
-func (h *HashIndexedUpserter) ensureUniqueIndex(ctx context.Context, tableIdent string, rawTable string, quotedUniqueKeys []string, uniqueKeys []string) error {
-	indexName := deriveIndexName(rawTable, uniqueKeys, "hash_idx")
-	indexIdent, err := quoteIdentifier(indexName)
+func (h *HashIndexedUpserter) ensureUniqueIndex(ctx context.Context, tableIdent string, rawTable string, quotedUniqueKeys []string, uniqueKeys []string) (err error) {
+	if h.hasIndex {
+		return nil
+	}
+	ctx, span := h.startSpan(ctx, "upsert.ensure_index", attribute.String("db.collection.name", rawTable))
+	defer func() { endSpan(span, err) }()
+
+	ref, err := ParseTableRef(rawTable)
+	if err != nil {
+		return fmt.Errorf("table: %w", err)
+	}
+	indexIdent, err := h.dialect.QuoteIdentifier(deriveIndexName(ref, uniqueKeys, "hash_idx"))
 	if err != nil {
 		return fmt.Errorf("index name: %w", err)
 	}
 
-	stmt := fmt.Sprintf(
-		"CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)",
-		indexIdent,
-		tableIdent,
-		strings.Join(quotedUniqueKeys, ", "),
-	)
-	if _, err := h.db.ExecContext(ctx, stmt); err != nil {
+	stmt := h.dialect.CreateUniqueIndex(indexIdent, tableIdent, quotedUniqueKeys)
+	span.SetAttributes(attribute.String("db.query.text", stmt))
+	h.countDDL(ctx, rawTable)
+	h.log().LogAttrs(ctx, slog.LevelDebug, "upsert ddl", slog.String("table", rawTable), slog.String("sql", stmt))
+	if _, err := h.db.ExecContext(ctx, stmt); err != nil && !h.dialect.IsIndexExists(err) {
 		return fmt.Errorf("create unique index: %w", err)
 	}
 	return nil
@@ -100,3 +100,94 @@ func TestHashIndexedUpserterUpsert_AllUniqueColumns(t *testing.T) {
 		t.Fatalf("unmet expectations: %v", err)
 	}
 }
+
+func TestHashIndexedUpserterUpsert_RecordsStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewHashIndexedUpserter(db)
+
+	columns := []string{"id", "name"}
+	rows := [][]any{
+		{int64(1), "John"},
+		{int64(2), "Jane"},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name" RETURNING (xmax = 0)`)).
+		WithArgs(int64(1), "John", int64(2), "Jane").
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true).AddRow(false))
+
+	var stats Stats
+	if err := upserter.Upsert(WithStats(context.Background(), &stats), "users", columns, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if stats.Rows() != 2 || stats.Inserted() != 1 || stats.Updated() != 1 {
+		t.Fatalf("stats = rows %d inserted %d updated %d, want 2/1/1", stats.Rows(), stats.Inserted(), stats.Updated())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestHashIndexedUpserterUpsert_QualifiedTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewHashIndexedUpserter(db)
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_`) + `[0-9a-f]{16}` + regexp.QuoteMeta(`" ON "analytics"."Order-Items" ("order id")`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "analytics"."Order-Items" ("order id", "unit ""price""") VALUES ($1, $2) ON CONFLICT ("order id") DO UPDATE SET "unit ""price""" = EXCLUDED."unit ""price"""`)).
+		WithArgs(int64(1), "9.99").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	columns := []string{"order id", `unit "price"`}
+	if err := upserter.Upsert(context.Background(), `analytics."Order-Items"`, columns, [][]any{{int64(1), "9.99"}}, []string{"order id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestHashIndexedUpserterUpsert_StrictIdentifiers(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewHashIndexedUpserter(db, WithStrictIdentifiers())
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "first name"}, [][]any{{int64(1), "John"}}, []string{"id"}); err == nil {
+		t.Fatal("expected error for unsafe column in strict mode, got nil")
+	}
+}
+
+func TestHashIndexedUpserterUpsert_ExistingUniqueIndex(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewHashIndexedUpserter(db, WithExistingUniqueIndex())
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`)).
+		WithArgs(int64(1), "John").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, [][]any{{int64(1), "John"}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -2,13 +2,132 @@ package upsert
 
 import (
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
 	"unicode"
 )
 
-// quoteIdentifier quotes a SQL identifier, ensuring internal quotes are escaped.
+// maxIdentifierBytes is PostgreSQL's NAMEDATALEN - 1. The server silently truncates
+// longer names, which could make two distinct names collide.
+const maxIdentifierBytes = 63
+
+// TableRef names a table, optionally qualified by its schema (its database on MySQL).
+type TableRef struct {
+	Schema string
+	Name   string
+}
+
+// ParseTableRef parses "name" or "schema.name". Either part may be double-quoted, as in
+// `"Sales"."Order-Items"`, to include dots; a doubled quote inside stands for one quote.
+// Unquoted parts are used verbatim, without PostgreSQL's folding to lower case, because
+// the upserters have always quoted the names they are given.
+func ParseTableRef(s string) (TableRef, error) {
+	var parts []string
+	rest := s
+	for {
+		part, tail, err := parseIdentifierPart(rest)
+		if err != nil {
+			return TableRef{}, fmt.Errorf("table %q: %w", s, err)
+		}
+		parts = append(parts, part)
+		if tail == "" {
+			break
+		}
+		if tail[0] != '.' {
+			return TableRef{}, fmt.Errorf("table %q: unexpected %q after identifier", s, tail)
+		}
+		rest = tail[1:]
+	}
+
+	switch len(parts) {
+	case 1:
+		return TableRef{Name: parts[0]}, nil
+	case 2:
+		return TableRef{Schema: parts[0], Name: parts[1]}, nil
+	default:
+		return TableRef{}, fmt.Errorf("table %q: want name or schema.name", s)
+	}
+}
+
+// parseIdentifierPart reads one plain or double-quoted identifier from the start of s.
+func parseIdentifierPart(s string) (part, rest string, err error) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexAny(s, `."`)
+		if end < 0 {
+			end = len(s)
+		}
+		if end == 0 {
+			return "", "", errors.New("empty identifier")
+		}
+		return s[:end], s[end:], nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '"' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '"' {
+			b.WriteByte('"')
+			i++
+			continue
+		}
+		if b.Len() == 0 {
+			return "", "", errors.New("empty identifier")
+		}
+		return b.String(), s[i+1:], nil
+	}
+	return "", "", errors.New("unterminated quoted identifier")
+}
+
+// String returns the reference in a form ParseTableRef reads back, quoting parts that
+// are not plain identifiers.
+func (t TableRef) String() string {
+	display := func(part string) string {
+		if isSafeIdentifier(part) {
+			return part
+		}
+		return `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	if t.Schema == "" {
+		return display(t.Name)
+	}
+	return display(t.Schema) + "." + display(t.Name)
+}
+
+// Quote returns the table reference quoted for d.
+func (t TableRef) Quote(d Dialect) (string, error) {
+	name, err := d.QuoteIdentifier(t.Name)
+	if err != nil {
+		return "", err
+	}
+	if t.Schema == "" {
+		return name, nil
+	}
+	schema, err := d.QuoteIdentifier(t.Schema)
+	if err != nil {
+		return "", err
+	}
+	return schema + "." + name, nil
+}
+
+// quoteWith quotes any identifier with the quote character, doubling embedded quotes.
+// It rejects only names no database can hold: empty ones and ones containing NUL.
+func quoteWith(name, quote string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty identifier")
+	}
+	if strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("identifier %q contains a NUL byte", name)
+	}
+	return quote + strings.ReplaceAll(name, quote, quote+quote) + quote, nil
+}
+
+// quoteIdentifier quotes a SQL identifier, ensuring internal quotes are escaped. It only
+// accepts names passing isSafeIdentifier; see WithStrictIdentifiers.
 func quoteIdentifier(name string) (string, error) {
 	if !isSafeIdentifier(name) {
 		return "", fmt.Errorf("invalid identifier %q", name)
@@ -40,7 +159,9 @@ func isSafeIdentifier(name string) bool {
 }
 
 // deriveIndexName builds a safe deterministic name for indexes over the given table and keys.
-func deriveIndexName(table string, uniqueKeys []string, suffix string) string {
+// The name depends on the parsed table, not its spelling, so analytics.users and
+// "analytics"."users" share an index name.
+func deriveIndexName(table TableRef, uniqueKeys []string, suffix string) string {
 	h := sha1.New()
 	keys := append([]string(nil), uniqueKeys...)
 	sort.Strings(keys)
@@ -50,7 +171,11 @@ func deriveIndexName(table string, uniqueKeys []string, suffix string) string {
 		_, _ = h.Write([]byte{'|'})
 	}
 
-	writePart(strings.ToLower(table))
+	name := table.Name
+	if table.Schema != "" {
+		name = table.Schema + "." + table.Name
+	}
+	writePart(strings.ToLower(name))
 	for _, key := range keys {
 		writePart(strings.ToLower(key))
 	}
@@ -1,6 +1,9 @@
 package upsert
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestIsSafeIdentifier(t *testing.T) {
 	tests := []struct {
@@ -61,23 +64,114 @@ func TestQuoteIdentifier(t *testing.T) {
 
 func TestDeriveIndexName(t *testing.T) {
 	t.Run("simple", func(t *testing.T) {
-		got := deriveIndexName("users", []string{"id"}, "hash_idx")
+		got := deriveIndexName(TableRef{Name: "users"}, []string{"id"}, "hash_idx")
 		if got != "idx_de7ebd7b26552dfc" {
 			t.Fatalf("deriveIndexName simple = %q", got)
 		}
 	})
 
 	t.Run("special characters", func(t *testing.T) {
-		got := deriveIndexName("User Accounts", []string{"Email-Address"}, "uniq")
+		got := deriveIndexName(TableRef{Name: "User Accounts"}, []string{"Email-Address"}, "uniq")
 		if got != "idx_2f4db383e4924ea8" {
 			t.Fatalf("deriveIndexName special = %q", got)
 		}
 	})
 
 	t.Run("numeric table", func(t *testing.T) {
-		got := deriveIndexName("123table", []string{"id"}, "hash_idx")
+		got := deriveIndexName(TableRef{Name: "123table"}, []string{"id"}, "hash_idx")
 		if got != "idx_a61bdf0a335a4148" {
 			t.Fatalf("deriveIndexName numeric = %q", got)
 		}
 	})
+
+	t.Run("quoted qualified table", func(t *testing.T) {
+		plain, _ := ParseTableRef("analytics.users")
+		quoted, _ := ParseTableRef(`"analytics"."users"`)
+		if a, b := deriveIndexName(plain, []string{"id"}, "hash_idx"), deriveIndexName(quoted, []string{"id"}, "hash_idx"); a != b {
+			t.Fatalf("deriveIndexName differs by spelling: %q vs %q", a, b)
+		}
+	})
+}
+
+func TestParseTableRef(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  TableRef
+		err   bool
+	}{
+		{name: "plain", input: "users", want: TableRef{Name: "users"}},
+		{name: "qualified", input: "analytics.users", want: TableRef{Schema: "analytics", Name: "users"}},
+		{name: "quoted", input: `"Sales"."Order-Items"`, want: TableRef{Schema: "Sales", Name: "Order-Items"}},
+		{name: "quotedDot", input: `"a.b"`, want: TableRef{Name: "a.b"}},
+		{name: "doubledQuote", input: `"say ""hi"""`, want: TableRef{Name: `say "hi"`}},
+		{name: "empty", input: "", err: true},
+		{name: "emptyPart", input: "analytics.", err: true},
+		{name: "tooManyParts", input: "db.analytics.users", err: true},
+		{name: "unterminated", input: `"users`, err: true},
+		{name: "trailingText", input: `"users"x`, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseTableRef(tc.input)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("ParseTableRef(%q) expected error, got %+v", tc.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTableRef(%q) unexpected error: %v", tc.input, err)
+			}
+			if got != tc.want {
+				t.Fatalf("ParseTableRef(%q) = %+v, want %+v", tc.input, got, tc.want)
+			}
+			again, err := ParseTableRef(got.String())
+			if err != nil || again != got {
+				t.Fatalf("ParseTableRef(%q) = %+v, %v; want round trip of %+v", got.String(), again, err, got)
+			}
+		})
+	}
+}
+
+func TestTableRefQuote(t *testing.T) {
+	ref := TableRef{Schema: "analytics", Name: `Order "Items"`}
+	got, err := ref.Quote(Postgres)
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if want := `"analytics"."Order ""Items"""`; got != want {
+		t.Fatalf("Quote() = %q, want %q", got, want)
+	}
+}
+
+func TestPostgresQuoteIdentifier_Limits(t *testing.T) {
+	if _, err := Postgres.QuoteIdentifier(strings.Repeat("a", maxIdentifierBytes)); err != nil {
+		t.Fatalf("QuoteIdentifier at the limit: %v", err)
+	}
+	if _, err := Postgres.QuoteIdentifier(strings.Repeat("a", maxIdentifierBytes+1)); err == nil {
+		t.Fatal("expected error for identifier over the length limit, got nil")
+	}
+	if _, err := Postgres.QuoteIdentifier("a\x00b"); err == nil {
+		t.Fatal("expected error for identifier with NUL, got nil")
+	}
+}
+
+func TestOptionsQuote_Strict(t *testing.T) {
+	lenient := newOptions(nil)
+	if got, err := lenient.quoteTable("analytics.user-events"); err != nil || got != `"analytics"."user-events"` {
+		t.Fatalf("quoteTable() = %q, %v", got, err)
+	}
+
+	strict := newOptions([]Option{WithStrictIdentifiers()})
+	if got, err := strict.quoteTable("analytics.users"); err != nil || got != `"analytics"."users"` {
+		t.Fatalf("strict quoteTable() = %q, %v", got, err)
+	}
+	if _, err := strict.quoteTable("analytics.user-events"); err == nil {
+		t.Fatal("expected strict error for table name with dash, got nil")
+	}
+	if _, err := strict.quote("first name"); err == nil {
+		t.Fatal("expected strict error for column name with space, got nil")
+	}
 }
@@ -0,0 +1,94 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// ColumnInfo describes a table column as reported by information_schema.
+type ColumnInfo struct {
+	Name string
+	// DataType is the information_schema data_type, e.g. "bigint" or "character varying".
+	DataType string
+	// UDTName is the underlying type name, e.g. "int8" or "_text" for text[].
+	UDTName          string
+	Nullable         bool
+	MaxLength        int
+	NumericPrecision int
+	NumericScale     int
+}
+
+const introspectColumnsQuery = `SELECT column_name, data_type, udt_name, is_nullable = 'YES',
+	COALESCE(character_maximum_length, 0), COALESCE(numeric_precision, 0), COALESCE(numeric_scale, 0)
+FROM information_schema.columns
+WHERE table_schema = COALESCE(NULLIF($2, ''), current_schema()) AND table_name = $1
+ORDER BY ordinal_position`
+
+// IntrospectColumns returns the columns of table in ordinal order. table is parsed with
+// ParseTableRef; without a schema the current schema is searched.
+func IntrospectColumns(ctx context.Context, db *sql.DB, table string) ([]ColumnInfo, error) {
+	ref, err := ParseTableRef(table)
+	if err != nil {
+		return nil, fmt.Errorf("introspect columns: %w", err)
+	}
+	rows, err := db.QueryContext(ctx, introspectColumnsQuery, ref.Name, ref.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("introspect columns: %w", err)
+	}
+	defer rows.Close()
+
+	var columns []ColumnInfo
+	for rows.Next() {
+		var col ColumnInfo
+		if err := rows.Scan(&col.Name, &col.DataType, &col.UDTName, &col.Nullable, &col.MaxLength, &col.NumericPrecision, &col.NumericScale); err != nil {
+			return nil, fmt.Errorf("introspect columns: %w", err)
+		}
+		columns = append(columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("introspect columns: %w", err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("introspect columns: table %q not found", table)
+	}
+	return columns, nil
+}
+
+// columnCache introspects each table from PostgreSQL once and remembers its columns, for
+// the wrappers that look up column types on every call, such as ValidatingUpserter and
+// CoercingUpserter. It does not notice later schema changes.
+type columnCache struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	columns map[string][]ColumnInfo
+}
+
+func newColumnCache(db *sql.DB) *columnCache {
+	return &columnCache{db: db, columns: make(map[string][]ColumnInfo)}
+}
+
+func (c *columnCache) get(ctx context.Context, table string) ([]ColumnInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if info, ok := c.columns[table]; ok {
+		return info, nil
+	}
+	info, err := IntrospectColumns(ctx, c.db, table)
+	if err != nil {
+		return nil, err
+	}
+	c.columns[table] = info
+	return info, nil
+}
+
+// IsTextual reports whether the column stores character data.
+func (c ColumnInfo) IsTextual() bool {
+	switch c.DataType {
+	case "text", "character varying", "character":
+		return true
+	}
+	return c.UDTName == "citext"
+}
@@ -0,0 +1,59 @@
+package upsert
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestIntrospectColumns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(introspectColumnsQuery)).
+		WithArgs("users", "").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "udt_name", "nullable", "max_length", "precision", "scale"}).
+			AddRow("id", "bigint", "int8", false, 0, 64, 0).
+			AddRow("name", "character varying", "varchar", true, 120, 0, 0))
+
+	got, err := IntrospectColumns(context.Background(), db, "users")
+	if err != nil {
+		t.Fatalf("IntrospectColumns: %v", err)
+	}
+	want := []ColumnInfo{
+		{Name: "id", DataType: "bigint", UDTName: "int8", NumericPrecision: 64},
+		{Name: "name", DataType: "character varying", UDTName: "varchar", Nullable: true, MaxLength: 120},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("IntrospectColumns() = %+v, want %+v", got, want)
+	}
+	if got[0].IsTextual() || !got[1].IsTextual() {
+		t.Fatalf("IsTextual mismatch: %v %v", got[0].IsTextual(), got[1].IsTextual())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestIntrospectColumns_MissingTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(introspectColumnsQuery)).
+		WithArgs("missing", "").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "udt_name", "nullable", "max_length", "precision", "scale"}))
+
+	if _, err := IntrospectColumns(context.Background(), db, "missing"); err == nil {
+		t.Fatal("expected error for missing table, got nil")
+	}
+}
@@ -0,0 +1,106 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// LockMode selects the PostgreSQL advisory locks NaiveUpserter and BatchedNaiveUpserter
+// take before checking which rows exist. On a table without a unique index, two
+// concurrent runs can otherwise both find a key missing and both insert it. The locks
+// only exclude writers that take them too.
+type LockMode int
+
+const (
+	// NoLock takes no advisory locks. It is the default.
+	NoLock LockMode = iota
+	// LockKeys locks a hash of every unique key tuple written by the transaction, after
+	// a shared lock on the table. Locks are taken in ascending order, so concurrent runs
+	// cannot deadlock on them. The keys are hashed by the database in their column types,
+	// so an uppercase UUID and its stored lowercase form take the same lock. A
+	// transaction writing more than maxKeyLocks rows takes the LockTable lock instead,
+	// keeping within max_locks_per_transaction (64 by default).
+	LockKeys
+	// LockTable locks the table as a whole, serializing all cooperating writers.
+	LockTable
+)
+
+// maxKeyLocks is the largest number of key locks LockKeys takes in one transaction.
+const maxKeyLocks = 64
+
+// WithAdvisoryLocks makes the naive strategies take advisory locks in their transactions
+// before the existence check. It needs the Postgres dialect.
+func WithAdvisoryLocks(mode LockMode) Option {
+	return func(o *options) {
+		o.locking = mode
+	}
+}
+
+// takeAdvisoryLocks locks what the configured LockMode asks for in tx, holding the locks
+// until tx ends. Key locks come with a shared lock on the table, so they also exclude the
+// exclusive table lock.
+func (o options) takeAdvisoryLocks(ctx context.Context, tx *sql.Tx, tableIdent string, quotedKeys []string, rows [][]any, keyIndexes []int) error {
+	if o.locking == NoLock {
+		return nil
+	}
+	if o.dialect.Name() != Postgres.Name() {
+		return fmt.Errorf("advisory locks need PostgreSQL, not %s", o.dialect.Name())
+	}
+
+	// The quoted name is canonical: users and "users" get the same lock.
+	tableID := advisoryLockID(tableIdent, "")
+	if o.locking == LockTable || len(rows) > maxKeyLocks {
+		const query = "SELECT pg_advisory_xact_lock($1)"
+		o.logStatement(ctx, query, []any{tableID})
+		if _, err := tx.ExecContext(ctx, query, tableID); err != nil {
+			return fmt.Errorf("take advisory locks: %w", err)
+		}
+		return nil
+	}
+
+	const shared = "SELECT pg_advisory_xact_lock_shared($1)"
+	o.logStatement(ctx, shared, []any{tableID})
+	if _, err := tx.ExecContext(ctx, shared, tableID); err != nil {
+		return fmt.Errorf("take advisory locks: %w", err)
+	}
+
+	args := make([]any, 0, len(rows)*len(keyIndexes)+1)
+	for _, row := range rows {
+		args = append(args, pick(row, keyIndexes)...)
+	}
+	args = append(args, tableID)
+	query := keyLockQuery(o.dialect, tableIdent, quotedKeys, len(rows))
+	o.logStatement(ctx, query, args)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("take advisory locks: %w", err)
+	}
+	return nil
+}
+
+// keyLockQuery locks the hashes of rowCount key tuples of bind parameters, followed by
+// a seed parameter, in ascending order. The keys pass through an empty SELECT from the
+// table first, so they take the column types and hash in their canonical text form.
+func keyLockQuery(d Dialect, tableIdent string, quotedKeys []string, rowCount int) string {
+	row := make([]string, len(quotedKeys))
+	for i, key := range quotedKeys {
+		row[i] = "v." + key
+	}
+	return fmt.Sprintf(
+		"SELECT pg_advisory_xact_lock(k) FROM unnest(ARRAY(SELECT DISTINCT hashtextextended(ROW(%s)::text, %s) FROM (%s) AS v ORDER BY 1)) AS k",
+		strings.Join(row, ", "),
+		d.Placeholder(rowCount*len(quotedKeys)+1),
+		unionKeySource(d, tableIdent, quotedKeys, rowCount),
+	)
+}
+
+// advisoryLockID hashes a table and key tuple into the bigint advisory lock space.
+func advisoryLockID(table, key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(table))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int64(h.Sum64())
+}
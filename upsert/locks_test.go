@@ -0,0 +1,128 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const (
+	tableLockQuery       = `SELECT pg_advisory_xact_lock($1)`
+	sharedTableLockQuery = `SELECT pg_advisory_xact_lock_shared($1)`
+)
+
+func TestNaiveUpserterUpsert_LocksKeysInOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewNaiveUpserter(db, WithAdvisoryLocks(LockKeys))
+	tableID := advisoryLockID(`"users"`, "")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sharedTableLockQuery)).
+		WithArgs(tableID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock(k) FROM unnest(ARRAY(SELECT DISTINCT hashtextextended(ROW(v."id")::text, $3) FROM (SELECT "id", 0 AS ord FROM "users" WHERE false UNION ALL SELECT $1, 0 UNION ALL SELECT $2, 1) AS v ORDER BY 1)) AS k`)).
+		WithArgs(int64(2), int64(1), tableID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	for _, id := range []int64{2, 1} {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT 1 FROM "users" WHERE "id" = $1 LIMIT 1`)).
+			WithArgs(id).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id") VALUES ($1)`)).
+			WithArgs(id).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{int64(2)}, {int64(1)}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestBatchedNaiveUpserterUpsert_KeyLocksFallBackToTableLock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewBatchedNaiveUpserter(db, WithAdvisoryLocks(LockKeys))
+	rows := make([][]any, maxKeyLocks+1)
+	for i := range rows {
+		rows[i] = []any{int64(i)}
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(tableLockQuery)).
+		WithArgs(advisoryLockID(`"users"`, "")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT v.ord FROM`)).
+		WillReturnRows(sqlmock.NewRows([]string{"ord"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id") VALUES`)).
+		WillReturnResult(sqlmock.NewResult(0, int64(len(rows))))
+	mock.ExpectCommit()
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestBatchedNaiveUpserterUpsert_LocksTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewBatchedNaiveUpserter(db, WithAdvisoryLocks(LockTable))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(tableLockQuery)).
+		WithArgs(advisoryLockID(`"users"`, "")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT v.ord FROM (SELECT "id", 0 AS ord FROM "users" WHERE false UNION ALL SELECT $1, 0 UNION ALL SELECT $2, 1) AS v`)).
+		WillReturnRows(sqlmock.NewRows([]string{"ord"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id") VALUES ($1), ($2)`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{int64(1)}, {int64(2)}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestAdvisoryLocks_NeedPostgres(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewBatchedNaiveUpserter(db, WithDialect(MySQL), WithAdvisoryLocks(LockKeys))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{int64(1)}}, []string{"id"}); err == nil {
+		t.Fatal("expected error for advisory locks on MySQL, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
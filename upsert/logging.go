@@ -0,0 +1,86 @@
+package upsert
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// WithLogger logs through logger: every call at Info level (Error when it fails),
+// statement re-preparations at Warn, and batches, unique index DDL and the SQL of every
+// statement at Debug. The DDL runs before every hash batch, hence the low level. Bound
+// values are left out unless WithLogValues is also given. The package logs nothing by
+// default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithLogValues adds the bound values to Debug statement logs, each passed through redact
+// first; a nil redact logs them unchanged. See RedactText.
+func WithLogValues(redact func(value any) any) Option {
+	return func(o *options) {
+		o.logValues = true
+		o.redact = redact
+	}
+}
+
+// RedactText replaces text values, where personal data usually lives, with their length
+// and passes other values through.
+func RedactText(value any) any {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("[redacted %d bytes]", len(v))
+	case []byte:
+		return fmt.Sprintf("[redacted %d bytes]", len(v))
+	}
+	return value
+}
+
+// log returns the configured logger, or one that discards everything.
+func (o options) log() *slog.Logger {
+	if o.logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return o.logger
+}
+
+// logStatement logs the SQL about to run at Debug level.
+func (o options) logStatement(ctx context.Context, query string, args []any) {
+	logger := o.log()
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{slog.String("sql", query), slog.Int("args", len(args))}
+	if o.logValues {
+		values := make([]any, len(args))
+		for i, arg := range args {
+			if o.redact != nil {
+				arg = o.redact(arg)
+			}
+			values[i] = arg
+		}
+		attrs = append(attrs, slog.Any("values", values))
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, "upsert statement", attrs...)
+}
+
+// logCall logs a finished Upsert call. stats is nil when the call was not counted.
+func (o options) logCall(ctx context.Context, strategy, table string, rows int, elapsed time.Duration, stats *Stats, err error) {
+	attrs := []slog.Attr{
+		slog.String("table", table),
+		slog.String("strategy", strategy),
+		slog.Int("rows", rows),
+		slog.Duration("duration", elapsed),
+	}
+	if stats != nil {
+		attrs = append(attrs, slog.Int64("inserted", stats.Inserted()), slog.Int64("updated", stats.Updated()))
+	}
+	if err != nil {
+		o.log().LogAttrs(ctx, slog.LevelError, "upsert failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	o.log().LogAttrs(ctx, slog.LevelInfo, "upsert", attrs...)
+}
@@ -0,0 +1,85 @@
+package upsert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// logRecords decodes JSON log lines into maps.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("decode log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestWithLogger_LogsCallBatchesAndStatements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	upserter := NewBatchedHashIndexedUpserter(db, WithLogger(logger)).(*BatchedHashIndexedUpserter).WithBatchSize(1)
+
+	for _, id := range []int64{1, 2} {
+		mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users"`)).WithArgs(id, "secret").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	rows := [][]any{{int64(1), "secret"}, {int64(2), "secret"}}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	var messages []string
+	for _, record := range logRecords(t, &buf) {
+		messages = append(messages, record["msg"].(string))
+		if record["msg"] == "upsert statement" {
+			if _, ok := record["values"]; ok {
+				t.Fatalf("statement log %v includes values without WithLogValues", record)
+			}
+		}
+	}
+	want := "upsert ddl, upsert statement, upsert batch, upsert ddl, upsert statement, upsert batch, upsert"
+	if got := strings.Join(messages, ", "); got != want {
+		t.Fatalf("messages = %s, want %s", got, want)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatalf("log contains a bound value: %s", buf.String())
+	}
+}
+
+func TestWithLogValues_Redacts(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	o := newOptions([]Option{WithLogger(logger), WithLogValues(RedactText)})
+
+	o.logStatement(context.Background(), `INSERT INTO "users" ("id", "email") VALUES ($1, $2)`, []any{int64(7), "jane@example.com"})
+
+	records := logRecords(t, &buf)
+	values, _ := records[0]["values"].([]any)
+	if len(values) != 2 || values[0] != float64(7) || values[1] != "[redacted 16 bytes]" {
+		t.Fatalf("values = %v, want [7 [redacted 16 bytes]]", records[0]["values"])
+	}
+}
+
+func TestWithLogger_SilentByDefault(t *testing.T) {
+	if newOptions(nil).log().Enabled(context.Background(), slog.LevelError) {
+		t.Fatal("expected the default logger to discard everything")
+	}
+}
@@ -0,0 +1,123 @@
+package upsert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MapUpserter upserts rows given as column-to-value maps whose key sets may differ.
+//
+// The two modes shape the calls to the wrapped Upserter differently:
+//
+//   - By default every row is widened to the union of all keys, missing columns are
+//     written as NULL, and all rows go to the wrapped Upserter in one call. Rows are not
+//     grouped, because writing the NULLs needs every column in every row.
+//   - WithMissingUnchanged groups rows by their key set and makes one call per group,
+//     in the order the key sets first appear, so columns absent from a row are left
+//     untouched on update. Groups are separate calls: a failing group leaves the
+//     groups before it written.
+type MapUpserter struct {
+	upserter         Upserter
+	missingUnchanged bool
+}
+
+func NewMapUpserter(upserter Upserter) *MapUpserter {
+	return &MapUpserter{upserter: upserter}
+}
+
+// WithMissingUnchanged returns a shallow copy that leaves absent columns unchanged instead
+// of writing NULL, at the cost of one call per distinct key set.
+func (m *MapUpserter) WithMissingUnchanged() *MapUpserter {
+	clone := *m
+	clone.missingUnchanged = true
+	return &clone
+}
+
+func (m *MapUpserter) Upsert(ctx context.Context, table string, rows []map[string]any, uniqueKeys []string) error {
+	if len(uniqueKeys) == 0 {
+		return errors.New("at least one unique key is required")
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	for idx, row := range rows {
+		for _, key := range uniqueKeys {
+			if _, ok := row[key]; !ok {
+				return fmt.Errorf("row %d: missing unique key %q", idx, key)
+			}
+		}
+	}
+
+	for _, group := range m.groupRows(rows) {
+		if err := m.upserter.Upsert(ctx, table, group.columns, group.rows, uniqueKeys); err != nil {
+			return fmt.Errorf("columns (%s): %w", strings.Join(group.columns, ", "), err)
+		}
+	}
+	return nil
+}
+
+// mapRowGroup holds rows sharing one column signature.
+type mapRowGroup struct {
+	columns []string
+	rows    [][]any
+}
+
+// groupRows returns one widened group of all rows by default, or with missingUnchanged a
+// group per column signature, in the order the signatures first appear.
+func (m *MapUpserter) groupRows(rows []map[string]any) []*mapRowGroup {
+	if !m.missingUnchanged {
+		columnSet := make(map[string]struct{})
+		for _, row := range rows {
+			for col := range row {
+				columnSet[col] = struct{}{}
+			}
+		}
+		group := &mapRowGroup{columns: sortedColumns(columnSet), rows: make([][]any, len(rows))}
+		for i, row := range rows {
+			group.rows[i] = mapRowValues(row, group.columns)
+		}
+		return []*mapRowGroup{group}
+	}
+
+	var groups []*mapRowGroup
+	bySignature := make(map[string]*mapRowGroup)
+	for _, row := range rows {
+		columnSet := make(map[string]struct{}, len(row))
+		for col := range row {
+			columnSet[col] = struct{}{}
+		}
+		columns := sortedColumns(columnSet)
+		signature := strings.Join(columns, "\x00")
+
+		group, ok := bySignature[signature]
+		if !ok {
+			group = &mapRowGroup{columns: columns}
+			bySignature[signature] = group
+			groups = append(groups, group)
+		}
+		group.rows = append(group.rows, mapRowValues(row, group.columns))
+	}
+	return groups
+}
+
+func sortedColumns(set map[string]struct{}) []string {
+	columns := make([]string, 0, len(set))
+	for col := range set {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// mapRowValues lays out row in column order; absent columns become nil.
+func mapRowValues(row map[string]any, columns []string) []any {
+	values := make([]any, len(columns))
+	for i, col := range columns {
+		values[i] = row[col]
+	}
+	return values
+}
@@ -0,0 +1,84 @@
+package upsert
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMapUpserterUpsert_MissingAsNull(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewMapUpserter(NewHashIndexedUpserter(db))
+
+	rows := []map[string]any{
+		{"id": int64(1), "name": "John"},
+		{"id": int64(2), "email": "jane@example.com"},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("email", "id", "name") VALUES ($1, $2, $3), ($4, $5, $6) ON CONFLICT ("id") DO UPDATE SET "email" = EXCLUDED."email", "name" = EXCLUDED."name"`)).
+		WithArgs(nil, int64(1), "John", "jane@example.com", int64(2), nil).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	if err := upserter.Upsert(context.Background(), "users", rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestMapUpserterUpsert_MissingUnchanged(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewMapUpserter(NewHashIndexedUpserter(db)).WithMissingUnchanged()
+
+	rows := []map[string]any{
+		{"id": int64(1), "name": "John"},
+		{"id": int64(2), "email": "jane@example.com"},
+		{"name": "Ann", "id": int64(3)},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`)).
+		WithArgs(int64(1), "John", int64(3), "Ann").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("email", "id") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "email" = EXCLUDED."email"`)).
+		WithArgs("jane@example.com", int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := upserter.Upsert(context.Background(), "users", rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestMapUpserterUpsert_MissingUniqueKey(t *testing.T) {
+	upserter := NewMapUpserter(NewHashIndexedUpserter(nil))
+
+	err := upserter.Upsert(context.Background(), "users", []map[string]any{{"name": "John"}}, []string{"id"})
+	if err == nil {
+		t.Fatal("expected error for missing unique key, got nil")
+	}
+	if !strings.Contains(err.Error(), `row 0: missing unique key "id"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package upsert
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusMetrics holds the Prometheus collectors the strategies update when configured with
+// WithMetrics. All series are labeled by table and strategy.
+type PrometheusMetrics struct {
+	rows          *prometheus.CounterVec
+	batchDuration *prometheus.HistogramVec
+	batchRows     *prometheus.HistogramVec
+	retries       *prometheus.CounterVec
+	ddl           *prometheus.CounterVec
+}
+
+// NewPrometheusMetrics creates the upsert collectors and registers them on reg:
+//
+//   - upsert_rows_total{result}: rows inserted, updated, upserted (written by a strategy or
+//     dialect that cannot tell inserts from updates) or rejected (in a failed call)
+//   - upsert_batch_duration_seconds and upsert_batch_rows: one observation per statement
+//     batch; strategies without batches observe each call
+//   - upsert_retries_total: calls repeated by the Retry middleware, see PrometheusMetrics.Sink
+//   - upsert_ddl_total: unique index statements executed
+func NewPrometheusMetrics(reg prometheus.Registerer) (*PrometheusMetrics, error) {
+	labels := []string{"table", "strategy"}
+	m := &PrometheusMetrics{
+		rows: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "upsert_rows_total",
+			Help: "Rows handled by upserts, by result: inserted, updated, upserted or rejected.",
+		}, append(labels, "result")),
+		batchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "upsert_batch_duration_seconds",
+			Help:    "Time to upsert one batch of rows.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 9),
+		}, labels),
+		batchRows: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "upsert_batch_rows",
+			Help:    "Rows per upserted batch.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 9),
+		}, labels),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "upsert_retries_total",
+			Help: "Upsert calls repeated after a transient error.",
+		}, labels),
+		ddl: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "upsert_ddl_total",
+			Help: "Unique index DDL statements executed.",
+		}, labels),
+	}
+	for _, c := range []prometheus.Collector{m.rows, m.batchDuration, m.batchRows, m.retries, m.ddl} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// WithMetrics records the strategy's work in m. Strategies then count inserted and updated
+// rows for every call, as if the context carried Stats.
+func WithMetrics(m *PrometheusMetrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// Sink returns a MetricsSink for the Metrics middleware that counts retries, and rows
+// rejected by validation before reaching the strategy, under the strategy label.
+func (m *PrometheusMetrics) Sink(strategy string) MetricsSink {
+	return metricsSink{metrics: m, strategy: strategy}
+}
+
+type metricsSink struct {
+	metrics  *PrometheusMetrics
+	strategy string
+}
+
+func (s metricsSink) ObserveUpsert(req *UpsertRequest, result *UpsertResult, err error) {
+	if result.Attempts > 1 {
+		s.metrics.retries.WithLabelValues(req.Table, s.strategy).Add(float64(result.Attempts - 1))
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		s.metrics.rows.WithLabelValues(req.Table, s.strategy, "rejected").Add(float64(len(req.Rows)))
+	}
+}
+
+type strategyKey struct{}
+
+// instrument runs call, one Upsert of strategy, inside its span, then logs it and records
+// its metrics. Strategies that do not batch have the whole call observed as one batch.
+func (o options) instrument(ctx context.Context, strategy, table string, columns []string, rows [][]any, batched bool, call func(context.Context) error) error {
+	ctx, span := o.startUpsertSpan(ctx, strategy, table, columns, rows)
+	ctx = context.WithValue(ctx, strategyKey{}, strategy)
+	ctx = o.startProgress(ctx, table, len(rows))
+
+	// The call gets Stats of its own when counting is wanted, so its counts are known
+	// even while the caller's Stats are shared with other calls.
+	outer := statsFromContext(ctx)
+	var stats *Stats
+	if outer != nil || o.metrics != nil {
+		stats = new(Stats)
+		ctx = WithStats(ctx, stats)
+	}
+
+	start := time.Now()
+	err := call(ctx)
+	elapsed := time.Since(start)
+	endSpan(span, err)
+
+	if outer != nil {
+		outer.add(stats.Rows(), stats.Inserted(), stats.Updated())
+	}
+	if len(rows) == 0 {
+		return err
+	}
+	o.logCall(ctx, strategy, table, len(rows), elapsed, stats, err)
+	if !batched {
+		o.observeBatch(ctx, table, 0, len(rows), elapsed, err)
+	}
+	if o.metrics != nil {
+		counts := map[string]int64{
+			"inserted": stats.Inserted(),
+			"updated":  stats.Updated(),
+			"upserted": stats.Rows() - stats.Inserted() - stats.Updated(),
+		}
+		if err != nil {
+			counts["rejected"] = int64(len(rows)) - stats.Rows()
+		}
+		for result, n := range counts {
+			if n > 0 {
+				o.metrics.rows.WithLabelValues(table, strategy, result).Add(float64(n))
+			}
+		}
+	}
+	return err
+}
+
+// observeBatch logs, records and reports the progress of one batch of rows, starting at input row first, that took elapsed.
+func (o options) observeBatch(ctx context.Context, table string, first, rows int, elapsed time.Duration, err error) {
+	strategy, _ := ctx.Value(strategyKey{}).(string)
+	attrs := []slog.Attr{
+		slog.String("table", table),
+		slog.String("strategy", strategy),
+		slog.Int("first_row", first),
+		slog.Int("rows", rows),
+		slog.Duration("duration", elapsed),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	o.log().LogAttrs(ctx, slog.LevelDebug, "upsert batch", attrs...)
+	if meter := progressFromContext(ctx); meter != nil && err == nil {
+		meter.Add(rows)
+	}
+
+	if o.metrics == nil {
+		return
+	}
+	o.metrics.batchDuration.WithLabelValues(table, strategy).Observe(elapsed.Seconds())
+	o.metrics.batchRows.WithLabelValues(table, strategy).Observe(float64(rows))
+}
+
+// countDDL records one executed DDL statement.
+func (o options) countDDL(ctx context.Context, table string) {
+	if o.metrics == nil {
+		return
+	}
+	strategy, _ := ctx.Value(strategyKey{}).(string)
+	o.metrics.ddl.WithLabelValues(table, strategy).Inc()
+}
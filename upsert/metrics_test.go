@@ -0,0 +1,117 @@
+package upsert
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheusMetrics_BatchedHashIndexed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	reg := prometheus.NewRegistry()
+	metrics, err := NewPrometheusMetrics(reg)
+	if err != nil {
+		t.Fatalf("NewPrometheusMetrics: %v", err)
+	}
+	upserter := NewBatchedHashIndexedUpserter(db, WithMetrics(metrics)).(*BatchedHashIndexedUpserter).WithBatchSize(2)
+
+	for _, inserted := range [][]bool{{true, false}, {true}} {
+		mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		result := sqlmock.NewRows([]string{"inserted"})
+		for _, ins := range inserted {
+			result.AddRow(ins)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(`RETURNING (xmax = 0)`)).WillReturnRows(result)
+	}
+
+	var stats Stats
+	rows := [][]any{{int64(1)}, {int64(2)}, {int64(3)}}
+	if err := upserter.Upsert(WithStats(context.Background(), &stats), "users", []string{"id"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.rows.WithLabelValues("users", "batched", "inserted")); got != 2 {
+		t.Fatalf("inserted = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.rows.WithLabelValues("users", "batched", "updated")); got != 1 {
+		t.Fatalf("updated = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.ddl.WithLabelValues("users", "batched")); got != 2 {
+		t.Fatalf("ddl = %v, want 2", got)
+	}
+	if got := testutil.CollectAndCount(metrics.batchRows); got != 1 {
+		t.Fatalf("batch size series = %d, want 1", got)
+	}
+	if stats.Inserted() != 2 || stats.Updated() != 1 {
+		t.Fatalf("caller stats = inserted %d updated %d, want 2/1", stats.Inserted(), stats.Updated())
+	}
+}
+
+func TestPrometheusMetrics_RejectedRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	metrics, err := NewPrometheusMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("NewPrometheusMetrics: %v", err)
+	}
+	upserter := NewHashIndexedUpserter(db, WithMetrics(metrics))
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).WillReturnError(&pq.Error{Code: "23502"})
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{int64(1)}, {int64(2)}}, []string{"id"}); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if got := testutil.ToFloat64(metrics.rows.WithLabelValues("users", "hash", "rejected")); got != 2 {
+		t.Fatalf("rejected = %v, want 2", got)
+	}
+	if got := testutil.CollectAndCount(metrics.batchDuration); got != 1 {
+		t.Fatalf("batch duration series = %d, want 1", got)
+	}
+}
+
+func TestPrometheusMetrics_SinkCountsRetries(t *testing.T) {
+	metrics, err := NewPrometheusMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("NewPrometheusMetrics: %v", err)
+	}
+	var calls []string
+	serialization := &pq.Error{Code: "40001"}
+	upserter := Chain(Metrics(metrics.Sink("batched")), Retry(3, time.Millisecond, slog.New(slog.DiscardHandler)))(countingUpserter(&calls, serialization))
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{1}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.retries.WithLabelValues("users", "batched")); got != 1 {
+		t.Fatalf("retries = %v, want 1", got)
+	}
+}
+
+func TestNewPrometheusMetrics_DuplicateRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := NewPrometheusMetrics(reg); err != nil {
+		t.Fatalf("NewPrometheusMetrics: %v", err)
+	}
+	if _, err := NewPrometheusMetrics(reg); err == nil {
+		t.Fatal("expected error registering the collectors twice, got nil")
+	}
+}
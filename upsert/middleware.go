@@ -0,0 +1,238 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// UpserterFunc adapts a function to the Upserter interface.
+type UpserterFunc func(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error
+
+func (f UpserterFunc) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	return f(ctx, table, columns, rows, uniqueKeys)
+}
+
+// Middleware wraps an Upserter with extra behavior.
+type Middleware func(Upserter) Upserter
+
+// Chain combines middlewares into one. The first is outermost: it sees each call first
+// and its result last.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(upserter Upserter) Upserter {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			upserter = middlewares[i](upserter)
+		}
+		return upserter
+	}
+}
+
+// UpsertRequest is one Upsert call as interceptors see it. An interceptor may modify the
+// request before passing it on.
+type UpsertRequest struct {
+	Table      string
+	Columns    []string
+	Rows       [][]any
+	UniqueKeys []string
+}
+
+// UpsertResult describes a finished call, including a failed one.
+type UpsertResult struct {
+	// Rows is the number of rows written. Inserted and Updated are only known when
+	// Counted is set, which happens when the call's context carries Stats (see WithStats).
+	Rows     int64
+	Inserted int64
+	Updated  int64
+	Counted  bool
+	// Duration is the time spent in the wrapped Upserter, over all attempts.
+	Duration time.Duration
+	Attempts int
+}
+
+// Handler runs a request through the rest of a chain. It returns a non-nil result, even
+// with an error.
+type Handler func(ctx context.Context, req *UpsertRequest) (*UpsertResult, error)
+
+// Interceptor handles a request, usually by calling next and inspecting its result. It
+// may also change the request or context first, call next several times, or not at all.
+type Interceptor func(ctx context.Context, req *UpsertRequest, next Handler) (*UpsertResult, error)
+
+// Intercept turns an interceptor into a Middleware. Results pass unchanged between
+// adjacent intercepted layers, so outer interceptors see what inner ones recorded.
+func Intercept(interceptor Interceptor) Middleware {
+	return func(upserter Upserter) Upserter {
+		return &interceptedUpserter{interceptor: interceptor, next: handlerFor(upserter)}
+	}
+}
+
+type interceptedUpserter struct {
+	interceptor Interceptor
+	next        Handler
+}
+
+func (i *interceptedUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	_, err := i.serve(ctx, &UpsertRequest{Table: table, Columns: columns, Rows: rows, UniqueKeys: uniqueKeys})
+	return err
+}
+
+func (i *interceptedUpserter) serve(ctx context.Context, req *UpsertRequest) (*UpsertResult, error) {
+	return i.interceptor(ctx, req, i.next)
+}
+
+// handlerFor calls upserter, collecting the call's counts when ctx asks for Stats.
+func handlerFor(upserter Upserter) Handler {
+	if inner, ok := upserter.(*interceptedUpserter); ok {
+		return inner.serve
+	}
+	return func(ctx context.Context, req *UpsertRequest) (*UpsertResult, error) {
+		result := &UpsertResult{Attempts: 1}
+		outer := statsFromContext(ctx)
+		var stats Stats
+		if outer != nil {
+			ctx = WithStats(ctx, &stats)
+		}
+
+		start := time.Now()
+		err := upserter.Upsert(ctx, req.Table, req.Columns, req.Rows, req.UniqueKeys)
+		result.Duration = time.Since(start)
+
+		if outer != nil {
+			outer.add(stats.Rows(), stats.Inserted(), stats.Updated())
+			result.Rows, result.Inserted, result.Updated, result.Counted = stats.Rows(), stats.Inserted(), stats.Updated(), true
+		} else if err == nil {
+			result.Rows = int64(len(req.Rows))
+		}
+		return result, err
+	}
+}
+
+// Logging logs every call at Info level, or at Error level when it fails.
+func Logging(logger *slog.Logger) Middleware {
+	return Intercept(func(ctx context.Context, req *UpsertRequest, next Handler) (*UpsertResult, error) {
+		result, err := next(ctx, req)
+		attrs := []slog.Attr{
+			slog.String("table", req.Table),
+			slog.Int("rows", len(req.Rows)),
+			slog.Duration("duration", result.Duration),
+			slog.Int("attempts", result.Attempts),
+		}
+		if result.Counted {
+			attrs = append(attrs, slog.Int64("inserted", result.Inserted), slog.Int64("updated", result.Updated))
+		}
+		if err != nil {
+			logger.LogAttrs(ctx, slog.LevelError, "upsert failed", append(attrs, slog.Any("error", err))...)
+		} else {
+			logger.LogAttrs(ctx, slog.LevelInfo, "upsert", attrs...)
+		}
+		return result, err
+	})
+}
+
+// MetricsSink receives the outcome of every call made through the Metrics middleware.
+type MetricsSink interface {
+	ObserveUpsert(req *UpsertRequest, result *UpsertResult, err error)
+}
+
+// Metrics reports every call to sink. It attaches Stats to contexts that have none, so
+// results are always Counted; strategies then ask the database which rows were inserted.
+func Metrics(sink MetricsSink) Middleware {
+	return Intercept(func(ctx context.Context, req *UpsertRequest, next Handler) (*UpsertResult, error) {
+		if statsFromContext(ctx) == nil {
+			ctx = WithStats(ctx, new(Stats))
+		}
+		result, err := next(ctx, req)
+		sink.ObserveUpsert(req, result, err)
+		return result, err
+	})
+}
+
+// Timing passes the wall time of every call, including inner middlewares, to observe.
+func Timing(observe func(req *UpsertRequest, elapsed time.Duration)) Middleware {
+	return Intercept(func(ctx context.Context, req *UpsertRequest, next Handler) (*UpsertResult, error) {
+		start := time.Now()
+		result, err := next(ctx, req)
+		observe(req, time.Since(start))
+		return result, err
+	})
+}
+
+// Validation checks rows with ValidateRows before passing them on; see ValidatingUpserter.
+func Validation(db *sql.DB) Middleware {
+	columns := newColumnCache(db)
+	return Intercept(func(ctx context.Context, req *UpsertRequest, next Handler) (*UpsertResult, error) {
+		if len(req.Rows) > 0 {
+			info, err := columns.get(ctx, req.Table)
+			if err != nil {
+				return &UpsertResult{}, err
+			}
+			if err := ValidateRows(info, req.Columns, req.Rows); err != nil {
+				return &UpsertResult{}, err
+			}
+		}
+		return next(ctx, req)
+	})
+}
+
+// Retry repeats calls failing with a transient error (see IsRetryable), up to attempts
+// calls in total, waiting backoff before the first retry and doubling it each time.
+// Upserts are idempotent, so repeating a partly applied call is safe; with Stats, rows
+// a failed attempt committed are counted again when retried. Every retry is logged at
+// Warn level with the error and the wait, through slog.Default() if logger is nil.
+func Retry(attempts int, backoff time.Duration, logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return Intercept(func(ctx context.Context, req *UpsertRequest, next Handler) (*UpsertResult, error) {
+		total := &UpsertResult{}
+		wait := backoff
+		for {
+			result, err := next(ctx, req)
+			total.Rows += result.Rows
+			total.Inserted += result.Inserted
+			total.Updated += result.Updated
+			total.Counted = result.Counted
+			total.Duration += result.Duration
+			total.Attempts += result.Attempts
+			if err == nil || total.Attempts >= attempts || !IsRetryable(err) {
+				return total, err
+			}
+
+			logger.LogAttrs(ctx, slog.LevelWarn, "upsert retry",
+				slog.String("table", req.Table),
+				slog.Int("attempt", total.Attempts),
+				slog.Duration("backoff", wait),
+				slog.Any("error", err),
+			)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return total, errors.Join(err, ctx.Err())
+			case <-timer.C:
+			}
+			wait *= 2
+		}
+	})
+}
+
+// IsRetryable reports whether err is transient: a serialization failure, a deadlock, a
+// lost or refused connection, or a server shutting down.
+func IsRetryable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var state interface{ SQLState() string }
+	if !errors.As(err, &state) {
+		return false
+	}
+	code := state.SQLState()
+	switch code {
+	case "40001", "40P01", "57P01", "57P02", "57P03": // serialization_failure, deadlock_detected, *_shutdown, cannot_connect_now
+		return true
+	}
+	return strings.HasPrefix(code, "08") // connection_exception
+}
@@ -0,0 +1,171 @@
+package upsert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// countingUpserter records every call and counts each row as inserted.
+func countingUpserter(calls *[]string, errs ...error) Upserter {
+	return UpserterFunc(func(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+		*calls = append(*calls, table)
+		if len(errs) > 0 {
+			err := errs[0]
+			errs = errs[1:]
+			if err != nil {
+				return err
+			}
+		}
+		if stats := statsFromContext(ctx); stats != nil {
+			stats.add(int64(len(rows)), int64(len(rows)), 0)
+		}
+		return nil
+	})
+}
+
+func TestChain_Order(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return Intercept(func(ctx context.Context, req *UpsertRequest, next Handler) (*UpsertResult, error) {
+			order = append(order, name+" in")
+			result, err := next(ctx, req)
+			order = append(order, name+" out")
+			return result, err
+		})
+	}
+
+	var calls []string
+	upserter := Chain(trace("a"), trace("b"))(countingUpserter(&calls))
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{1}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if got, want := strings.Join(order, ", "), "a in, b in, b out, a out"; got != want {
+		t.Fatalf("order = %s, want %s", got, want)
+	}
+}
+
+func TestIntercept_ModifiesRequest(t *testing.T) {
+	var calls []string
+	prefix := Intercept(func(ctx context.Context, req *UpsertRequest, next Handler) (*UpsertResult, error) {
+		req.Table = "staging." + req.Table
+		return next(ctx, req)
+	})
+
+	if err := prefix(countingUpserter(&calls)).Upsert(context.Background(), "users", []string{"id"}, [][]any{{1}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if len(calls) != 1 || calls[0] != "staging.users" {
+		t.Fatalf("calls = %v, want [staging.users]", calls)
+	}
+}
+
+type recordingSink struct {
+	results []*UpsertResult
+	errs    []error
+}
+
+func (s *recordingSink) ObserveUpsert(_ *UpsertRequest, result *UpsertResult, err error) {
+	s.results = append(s.results, result)
+	s.errs = append(s.errs, err)
+}
+
+func TestRetry_TransientErrors(t *testing.T) {
+	var calls []string
+	var logs, retries bytes.Buffer
+	sink := &recordingSink{}
+	serialization := &pq.Error{Code: "40001"}
+	upserter := Chain(
+		Logging(slog.New(slog.NewTextHandler(&logs, nil))),
+		Metrics(sink),
+		Retry(3, time.Millisecond, slog.New(slog.NewTextHandler(&retries, nil))),
+	)(countingUpserter(&calls, serialization, serialization))
+
+	var stats Stats
+	ctx := WithStats(context.Background(), &stats)
+	if err := upserter.Upsert(ctx, "users", []string{"id"}, [][]any{{1}, {2}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if len(calls) != 3 {
+		t.Fatalf("calls = %d, want 3", len(calls))
+	}
+	if stats.Inserted() != 2 {
+		t.Fatalf("stats.Inserted() = %d, want 2", stats.Inserted())
+	}
+	if len(sink.results) != 1 || sink.results[0].Attempts != 3 || sink.results[0].Inserted != 2 || !sink.results[0].Counted {
+		t.Fatalf("sink results = %+v, want one counted result after 3 attempts", sink.results)
+	}
+	if !strings.Contains(logs.String(), "attempts=3") || !strings.Contains(logs.String(), "inserted=2") {
+		t.Fatalf("log = %q, want attempts and counts", logs.String())
+	}
+	if n := strings.Count(retries.String(), "level=WARN msg=\"upsert retry\""); n != 2 {
+		t.Fatalf("retry log = %q, want 2 warnings", retries.String())
+	}
+	if !strings.Contains(retries.String(), "backoff=1ms") || !strings.Contains(retries.String(), "backoff=2ms") || !strings.Contains(retries.String(), "error=\"pq: ") {
+		t.Fatalf("retry log = %q, want the backoffs and the error", retries.String())
+	}
+}
+
+func TestRetry_StopsOnPermanentError(t *testing.T) {
+	var calls []string
+	permanent := &pq.Error{Code: "23502"} // not_null_violation
+	upserter := Retry(5, time.Millisecond, slog.New(slog.DiscardHandler))(countingUpserter(&calls, permanent, nil))
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{1}}, []string{"id"}); !errors.Is(err, permanent) {
+		t.Fatalf("Upsert() = %v, want %v", err, permanent)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("calls = %d, want 1", len(calls))
+	}
+}
+
+func TestMetrics_CountsWithoutCallerStats(t *testing.T) {
+	var calls []string
+	sink := &recordingSink{}
+	upserter := Metrics(sink)(countingUpserter(&calls))
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{1}, {2}, {3}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if got := sink.results[0]; !got.Counted || got.Rows != 3 || got.Inserted != 3 {
+		t.Fatalf("result = %+v, want 3 counted inserts", got)
+	}
+}
+
+func TestTiming(t *testing.T) {
+	var calls []string
+	var observed []string
+	upserter := Timing(func(req *UpsertRequest, elapsed time.Duration) {
+		observed = append(observed, req.Table)
+	})(countingUpserter(&calls))
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{1}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if len(observed) != 1 || observed[0] != "users" {
+		t.Fatalf("observed = %v, want [users]", observed)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: &pq.Error{Code: "40P01"}, want: true},
+		{err: &pq.Error{Code: "08006"}, want: true},
+		{err: &pq.Error{Code: "23505"}, want: false},
+		{err: errors.New("boom"), want: false},
+	}
+	for _, tc := range tests {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Fatalf("IsRetryable(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
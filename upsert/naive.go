@@ -6,17 +6,26 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 type NaiveUpserter struct {
 	db *sql.DB
+	options
 }
 
-func NewNaiveUpserter(db *sql.DB) Upserter {
-	return &NaiveUpserter{db: db}
+func NewNaiveUpserter(db *sql.DB, opts ...Option) Upserter {
+	return &NaiveUpserter{db: db, options: newOptions(opts)}
 }
 
 func (n *NaiveUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	return n.instrument(ctx, "naive", table, columns, rows, false, func(ctx context.Context) error {
+		return n.upsert(ctx, table, columns, rows, uniqueKeys)
+	})
+}
+
+func (n *NaiveUpserter) upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) (err error) {
 	if len(columns) == 0 {
 		return errors.New("at least one column is required")
 	}
@@ -27,7 +36,7 @@ func (n *NaiveUpserter) Upsert(ctx context.Context, table string, columns []stri
 		return nil
 	}
 
-	tableIdent, err := quoteIdentifier(table)
+	tableIdent, err := n.quoteTable(table)
 	if err != nil {
 		return fmt.Errorf("table: %w", err)
 	}
@@ -35,7 +44,7 @@ func (n *NaiveUpserter) Upsert(ctx context.Context, table string, columns []stri
 	columnIndex := make(map[string]int, len(columns))
 	quotedColumns := make([]string, len(columns))
 	for i, col := range columns {
-		quoted, err := quoteIdentifier(col)
+		quoted, err := n.quote(col)
 		if err != nil {
 			return fmt.Errorf("column[%d]: %w", i, err)
 		}
@@ -49,14 +58,53 @@ func (n *NaiveUpserter) Upsert(ctx context.Context, table string, columns []stri
 		if _, ok := columnIndex[key]; !ok {
 			return fmt.Errorf("unique key %q not found in columns", key)
 		}
-		quotedKey, err := quoteIdentifier(key)
+		quotedKey, err := n.quote(key)
 		if err != nil {
 			return fmt.Errorf("unique key %q: %w", key, err)
 		}
 		quotedUniqueKeys[i] = quotedKey
-		whereClauses[i] = fmt.Sprintf("%s = $%d", quotedKey, i+1)
+		whereClauses[i] = fmt.Sprintf("%s = %s", quotedKey, n.dialect.Placeholder(i+1))
+	}
+
+	checkQuery := func() string {
+		return fmt.Sprintf("SELECT 1 FROM %s WHERE %s LIMIT 1", tableIdent, strings.Join(whereClauses, " AND "))
+	}
+	insertQuery := func() string {
+		placeholders := make([]string, len(columns))
+		for i := range placeholders {
+			placeholders[i] = n.dialect.Placeholder(i + 1)
+		}
+		return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableIdent, strings.Join(quotedColumns, ", "), strings.Join(placeholders, ", "))
+	}
+	updateQuery := func() string {
+		setClauses := make([]string, len(columns))
+		for i := range columns {
+			setClauses[i] = fmt.Sprintf("%s = %s", quotedColumns[i], n.dialect.Placeholder(i+1))
+		}
+		keyClauses := make([]string, len(uniqueKeys))
+		for i, quotedKey := range quotedUniqueKeys {
+			keyClauses[i] = fmt.Sprintf("%s = %s", quotedKey, n.dialect.Placeholder(len(columns)+i+1))
+		}
+		return fmt.Sprintf("UPDATE %s SET %s WHERE %s", tableIdent, strings.Join(setClauses, ", "), strings.Join(keyClauses, " AND "))
 	}
 
+	// Statements are prepared before the transaction begins; see options.prepare.
+	checkStmt, err := n.prepare(ctx, newStatementKey(n.db, table, columns, uniqueKeys, 1, "exists"), checkQuery)
+	if err != nil {
+		return fmt.Errorf("prepare existence check: %w", err)
+	}
+	defer checkStmt.release()
+	insertStmt, err := n.prepare(ctx, newStatementKey(n.db, table, columns, uniqueKeys, 1, "insert"), insertQuery)
+	if err != nil {
+		return fmt.Errorf("prepare insert: %w", err)
+	}
+	defer insertStmt.release()
+	updateStmt, err := n.prepare(ctx, newStatementKey(n.db, table, columns, uniqueKeys, 1, "update"), updateQuery)
+	if err != nil {
+		return fmt.Errorf("prepare update: %w", err)
+	}
+	defer updateStmt.release()
+
 	tx, err := n.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
@@ -69,82 +117,98 @@ func (n *NaiveUpserter) Upsert(ctx context.Context, table string, columns []stri
 		}
 	}()
 
-	checkQuery := fmt.Sprintf("SELECT 1 FROM %s WHERE %s LIMIT 1", tableIdent, strings.Join(whereClauses, " AND "))
 	for rowIdx, row := range rows {
 		if len(row) != len(columns) {
 			return fmt.Errorf("row %d: columns (%d) and values (%d) length mismatch", rowIdx, len(columns), len(row))
 		}
+	}
+
+	keyIndexes := make([]int, len(uniqueKeys))
+	for i, key := range uniqueKeys {
+		keyIndexes[i] = columnIndex[key]
+	}
+	if err := n.takeAdvisoryLocks(ctx, tx, tableIdent, quotedUniqueKeys, rows, keyIndexes); err != nil {
+		return err
+	}
+
+	var inserted, updated int64
+	// Each group of naiveSpanRows rows gets a child span; a failing row's error ends up on its group.
+	groupCtx, span := ctx, trace.Span(nil)
+	defer func() {
+		if span != nil {
+			endSpan(span, err)
+		}
+	}()
+	for rowIdx, row := range rows {
+		if rowIdx%naiveSpanRows == 0 {
+			if span != nil {
+				endSpan(span, nil)
+			}
+			groupCtx, span = n.startSpan(ctx, "upsert.rows", batchAttributes(rowIdx, min(rowIdx+naiveSpanRows, len(rows)))...)
+		}
 
 		whereArgs := make([]any, len(uniqueKeys))
 		for i, key := range uniqueKeys {
 			whereArgs[i] = row[columnIndex[key]]
 		}
 
-		var one int
-		exists := false
-		switch err := tx.QueryRowContext(ctx, checkQuery, whereArgs...).Scan(&one); {
-		case errors.Is(err, sql.ErrNoRows):
-			exists = false
-		case err != nil:
+		exists, err := n.rowExists(groupCtx, tx, checkStmt, whereArgs)
+		if err != nil {
 			return fmt.Errorf("row %d: check existing row: %w", rowIdx, err)
-		default:
-			exists = true
 		}
 
 		if exists {
-			if err := n.executeUpdate(ctx, tx, tableIdent, quotedColumns, columns, columnIndex, row, uniqueKeys, quotedUniqueKeys); err != nil {
+			if err := n.executeUpdate(groupCtx, tx, updateStmt, columnIndex, row, uniqueKeys); err != nil {
 				return fmt.Errorf("row %d: %w", rowIdx, err)
 			}
+			updated++
 		} else {
-			if err := n.executeInsert(ctx, tx, tableIdent, quotedColumns, row); err != nil {
+			if err := n.executeInsert(groupCtx, tx, insertStmt, row); err != nil {
 				return fmt.Errorf("row %d: %w", rowIdx, err)
 			}
+			inserted++
 		}
 	}
+	endSpan(span, nil)
+	span = nil
 
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("commit tx: %w", err)
 	}
 	committed = true
+	if stats := statsFromContext(ctx); stats != nil {
+		stats.add(int64(len(rows)), inserted, updated)
+	}
 	return nil
 }
 
-func (n *NaiveUpserter) executeInsert(ctx context.Context, tx *sql.Tx, table string, quotedColumns []string, row []any) error {
-	placeholders := make([]string, len(row))
-	for i := range placeholders {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
+func (n *NaiveUpserter) rowExists(ctx context.Context, tx *sql.Tx, stmt *preparedStatement, args []any) (bool, error) {
+	rows, err := stmt.queryRows(ctx, n.db, tx, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
 	}
+	defer rows.Close()
+	exists := rows.Next()
+	return exists, rows.Err()
+}
 
-	insertQuery := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(quotedColumns, ", "), strings.Join(placeholders, ", "))
-	if _, err := tx.ExecContext(ctx, insertQuery, row...); err != nil {
+func (n *NaiveUpserter) executeInsert(ctx context.Context, tx *sql.Tx, stmt *preparedStatement, row []any) error {
+	if _, err := stmt.exec(ctx, n.db, tx, row...); err != nil {
 		return fmt.Errorf("insert row: %w", err)
 	}
 	return nil
 }
 
-func (n *NaiveUpserter) executeUpdate(ctx context.Context, tx *sql.Tx, table string, quotedColumns []string, columns []string, columnIndex map[string]int, row []any, uniqueKeys []string, quotedUniqueKeys []string) error {
-	setClauses := make([]string, len(columns))
-	args := make([]any, 0, len(columns)+len(uniqueKeys))
-	idx := 1
-	for i := range columns {
-		setClauses[i] = fmt.Sprintf("%s = $%d", quotedColumns[i], idx)
-		args = append(args, row[i])
-		idx++
-	}
-
-	whereClauses := make([]string, len(uniqueKeys))
-	for i, key := range uniqueKeys {
-		quotedKey := quotedUniqueKeys[i]
-		if quotedKey == "" {
-			return fmt.Errorf("unique key %q: missing quoted identifier", key)
-		}
-		whereClauses[i] = fmt.Sprintf("%s = $%d", quotedKey, idx)
+func (n *NaiveUpserter) executeUpdate(ctx context.Context, tx *sql.Tx, stmt *preparedStatement, columnIndex map[string]int, row []any, uniqueKeys []string) error {
+	args := make([]any, 0, len(row)+len(uniqueKeys))
+	args = append(args, row...)
+	for _, key := range uniqueKeys {
 		args = append(args, row[columnIndex[key]])
-		idx++
 	}
-
-	updateQuery := fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(setClauses, ", "), strings.Join(whereClauses, " AND "))
-	if _, err := tx.ExecContext(ctx, updateQuery, args...); err != nil {
+	if _, err := stmt.exec(ctx, n.db, tx, args...); err != nil {
 		return fmt.Errorf("update row: %w", err)
 	}
 	return nil
@@ -84,3 +84,42 @@ func TestNaiveUpserterUpsert_RowLengthMismatch(t *testing.T) {
 		t.Fatalf("unmet expectations: %v", err)
 	}
 }
+
+func TestNaiveUpserterUpsert_RecordsStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewNaiveUpserter(db)
+
+	columns := []string{"id", "name"}
+	rows := [][]any{
+		{int64(1), "John"},
+		{int64(2), "Jane"},
+		{int64(3), "Ann"},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT 1 FROM "users"`).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(1))
+	mock.ExpectExec(`UPDATE "users"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT 1 FROM "users"`).WithArgs(int64(2)).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`INSERT INTO "users"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT 1 FROM "users"`).WithArgs(int64(3)).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`INSERT INTO "users"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var stats Stats
+	if err := upserter.Upsert(WithStats(context.Background(), &stats), "users", columns, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if stats.Rows() != 3 || stats.Inserted() != 2 || stats.Updated() != 1 {
+		t.Fatalf("stats = rows %d inserted %d updated %d, want 3/2/1", stats.Rows(), stats.Inserted(), stats.Updated())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
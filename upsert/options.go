@@ -0,0 +1,89 @@
+package upsert
+
+import (
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures an upserter at construction time.
+type Option func(*options)
+
+type options struct {
+	dialect    Dialect
+	statements *StatementCache
+	locking    LockMode
+	strict     bool
+	tracer     trace.Tracer
+	metrics    *PrometheusMetrics
+	logger     *slog.Logger
+	logValues  bool
+	redact     func(any) any
+	progress   func(Progress)
+	hasIndex   bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{dialect: Postgres}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// quote quotes a column or other single identifier.
+func (o options) quote(name string) (string, error) {
+	if o.strict && !isSafeIdentifier(name) {
+		return "", fmt.Errorf("invalid identifier %q", name)
+	}
+	return o.dialect.QuoteIdentifier(name)
+}
+
+// quoteTable parses table with ParseTableRef and quotes it.
+func (o options) quoteTable(table string) (string, error) {
+	ref, err := ParseTableRef(table)
+	if err != nil {
+		return "", err
+	}
+	if o.strict && (!isSafeIdentifier(ref.Name) || ref.Schema != "" && !isSafeIdentifier(ref.Schema)) {
+		return "", fmt.Errorf("invalid identifier %q", table)
+	}
+	return ref.Quote(o.dialect)
+}
+
+// WithDialect selects the SQL dialect. The default is Postgres.
+func WithDialect(d Dialect) Option {
+	return func(o *options) {
+		if d != nil {
+			o.dialect = d
+		}
+	}
+}
+
+// WithStatementCache makes the upserter run its generated statements through cache,
+// preparing each statement shape once and reusing it. Without it every call sends
+// freshly formatted SQL.
+func WithStatementCache(cache *StatementCache) Option {
+	return func(o *options) {
+		o.statements = cache
+	}
+}
+
+// WithExistingUniqueIndex tells the hash strategies that a unique index over the unique
+// keys already exists, so they skip their CREATE UNIQUE INDEX IF NOT EXISTS. PostgreSQL
+// checks table ownership before IF NOT EXISTS, and a differently named index would be
+// created next to the existing one.
+func WithExistingUniqueIndex() Option {
+	return func(o *options) {
+		o.hasIndex = true
+	}
+}
+
+// WithStrictIdentifiers only accepts table, schema and column names made of letters,
+// digits and underscores, not starting with a digit. By default any name is quoted.
+func WithStrictIdentifiers() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
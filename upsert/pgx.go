@@ -0,0 +1,36 @@
+package upsert
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PgxConn is the part of *pgx.Conn and *pgxpool.Pool the pgx strategies use.
+type PgxConn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// scanInserted counts the booleans yielded by a query carrying ReturningInserted.
+func scanInserted(rows pgx.Rows) (inserted, updated int64, err error) {
+	defer rows.Close()
+	for rows.Next() {
+		var isInsert bool
+		if err := rows.Scan(&isInsert); err != nil {
+			return 0, 0, fmt.Errorf("scan upsert result: %w", err)
+		}
+		if isInsert {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("exec upsert: %w", err)
+	}
+	return inserted, updated, nil
+}
@@ -0,0 +1,99 @@
+package upsert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PgxBatchUpserter sends all upsert statements for a call in one pgx.Batch, so they are
+// pipelined in a single round trip. PostgreSQL runs a pipelined batch as one implicit
+// transaction. Statements of the same size share their text and reuse pgx's prepared
+// statement cache.
+type PgxBatchUpserter struct {
+	conn             PgxConn
+	rowsPerStatement int
+}
+
+func NewPgxBatchUpserter(conn PgxConn) Upserter {
+	return &PgxBatchUpserter{conn: conn, rowsPerStatement: 100}
+}
+
+// WithRowsPerStatement returns a shallow copy that puts up to n rows in each queued
+// statement; 1 queues prepared single-row upserts.
+func (p *PgxBatchUpserter) WithRowsPerStatement(n int) Upserter {
+	clone := *p
+	clone.rowsPerStatement = n
+	return &clone
+}
+
+func (p *PgxBatchUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	if p.rowsPerStatement <= 0 {
+		return errors.New("rows per statement must be positive")
+	}
+	plan, err := newUpsertPlan(newOptions(nil), table, columns, rows, uniqueKeys)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	indexStmt, err := plan.uniqueIndexStatement(uniqueKeys)
+	if err != nil {
+		return err
+	}
+	if _, err := p.conn.Exec(ctx, indexStmt); err != nil {
+		return fmt.Errorf("create unique index: %w", err)
+	}
+
+	stats := statsFromContext(ctx)
+	perStatement := min(p.rowsPerStatement, Postgres.MaxPlaceholders()/len(columns))
+
+	batch := &pgx.Batch{}
+	for start := 0; start < len(rows); start += perStatement {
+		end := min(start+perStatement, len(rows))
+		query := plan.insertValues(end - start)
+		if stats != nil {
+			query += " " + Postgres.ReturningInserted()
+		}
+		args := make([]any, 0, (end-start)*len(columns))
+		for _, row := range rows[start:end] {
+			args = append(args, row...)
+		}
+		batch.Queue(query, args...)
+	}
+
+	results := p.conn.SendBatch(ctx, batch)
+	var inserted, updated int64
+	for i := 0; i < batch.Len(); i++ {
+		if stats == nil {
+			if _, err := results.Exec(); err != nil {
+				results.Close()
+				return fmt.Errorf("statement %d: exec upsert: %w", i, err)
+			}
+			continue
+		}
+		queried, err := results.Query()
+		if err != nil {
+			results.Close()
+			return fmt.Errorf("statement %d: exec upsert: %w", i, err)
+		}
+		ins, upd, err := scanInserted(queried)
+		if err != nil {
+			results.Close()
+			return fmt.Errorf("statement %d: %w", i, err)
+		}
+		inserted += ins
+		updated += upd
+	}
+	if err := results.Close(); err != nil {
+		return fmt.Errorf("close batch: %w", err)
+	}
+	if stats != nil {
+		stats.add(int64(len(rows)), inserted, updated)
+	}
+	return nil
+}
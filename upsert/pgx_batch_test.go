@@ -0,0 +1,74 @@
+package upsert
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPgxBatchUpserterUpsert_Pipelines(t *testing.T) {
+	conn := &fakePgxConn{}
+	upserter := NewPgxBatchUpserter(conn).(*PgxBatchUpserter).WithRowsPerStatement(2)
+
+	rows := [][]any{{int64(1), "John"}, {int64(2), "Jane"}, {int64(3), "Joe"}}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	wantCalls := []string{
+		`exec: CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`,
+		`batch: INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`,
+		`batch: INSERT INTO "users" ("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`,
+	}
+	if !reflect.DeepEqual(conn.calls, wantCalls) {
+		t.Fatalf("calls = %#v, want %#v", conn.calls, wantCalls)
+	}
+	wantArgs := [][]any{nil, {int64(1), "John", int64(2), "Jane"}, {int64(3), "Joe"}}
+	if !reflect.DeepEqual(conn.args, wantArgs) {
+		t.Fatalf("args = %#v, want %#v", conn.args, wantArgs)
+	}
+}
+
+func TestPgxBatchUpserterUpsert_RecordsStats(t *testing.T) {
+	conn := &fakePgxConn{returning: [][]bool{{true, false}}}
+	upserter := NewPgxBatchUpserter(conn)
+
+	var stats Stats
+	ctx := WithStats(context.Background(), &stats)
+	rows := [][]any{{int64(1), "John"}, {int64(2), "Jane"}}
+	if err := upserter.Upsert(ctx, "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	want := `batch: INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name" RETURNING (xmax = 0)`
+	if len(conn.calls) != 2 || conn.calls[1] != want {
+		t.Fatalf("calls = %#v, want batch %q", conn.calls, want)
+	}
+	if stats.Rows() != 2 || stats.Inserted() != 1 || stats.Updated() != 1 {
+		t.Fatalf("stats = rows %d inserted %d updated %d, want 2/1/1", stats.Rows(), stats.Inserted(), stats.Updated())
+	}
+}
+
+func TestPgxBatchUpserterUpsert_StatementError(t *testing.T) {
+	conn := &fakePgxConn{
+		failOn: `batch: INSERT INTO "users" ("id") VALUES ($1) ON CONFLICT ("id") DO NOTHING`,
+	}
+	upserter := NewPgxBatchUpserter(conn)
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{int64(1)}}, []string{"id"}); err == nil {
+		t.Fatal("expected statement error, got nil")
+	}
+}
+
+func TestPgxBatchUpserterUpsert_DuplicateKeys(t *testing.T) {
+	conn := &fakePgxConn{}
+	upserter := NewPgxBatchUpserter(conn)
+
+	rows := [][]any{{int64(1), "John"}, {int64(1), "Jane"}}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err == nil {
+		t.Fatal("expected duplicate keys error, got nil")
+	}
+	if len(conn.calls) != 0 {
+		t.Fatalf("expected no statements, got %v", conn.calls)
+	}
+}
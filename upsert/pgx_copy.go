@@ -0,0 +1,93 @@
+package upsert
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// pgxStageTable is the temporary table PgxCopyUpserter copies rows into. It is dropped
+// when the transaction ends, so concurrent sessions never see each other's stage.
+const pgxStageTable = "upsert_stage"
+
+// PgxCopyUpserter streams rows with COPY into a temporary table shaped like the target
+// columns, then merges them with one INSERT ... SELECT ... ON CONFLICT, all in one
+// transaction.
+type PgxCopyUpserter struct {
+	conn PgxConn
+}
+
+func NewPgxCopyUpserter(conn PgxConn) Upserter {
+	return &PgxCopyUpserter{conn: conn}
+}
+
+func (p *PgxCopyUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	plan, err := newUpsertPlan(newOptions(nil), table, columns, rows, uniqueKeys)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	indexStmt, err := plan.uniqueIndexStatement(uniqueKeys)
+	if err != nil {
+		return err
+	}
+	if _, err := p.conn.Exec(ctx, indexStmt); err != nil {
+		return fmt.Errorf("create unique index: %w", err)
+	}
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	stageIdent, err := Postgres.QuoteIdentifier(pgxStageTable)
+	if err != nil {
+		return err
+	}
+	columnList := strings.Join(plan.quotedColumns, ", ")
+	createStage := fmt.Sprintf("CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA", stageIdent, columnList, plan.tableIdent)
+	if _, err := tx.Exec(ctx, createStage); err != nil {
+		return fmt.Errorf("create stage table: %w", err)
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{pgxStageTable}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("copy rows: %w", err)
+	}
+
+	merge := fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT %s FROM %s %s",
+		plan.tableIdent,
+		columnList,
+		columnList,
+		stageIdent,
+		Postgres.UpsertClause(plan.quotedUniqueKeys, plan.updateColumns),
+	)
+	stats := statsFromContext(ctx)
+	var inserted, updated int64
+	if stats == nil {
+		if _, err := tx.Exec(ctx, merge); err != nil {
+			return fmt.Errorf("merge stage table: %w", err)
+		}
+	} else {
+		queried, err := tx.Query(ctx, merge+" "+Postgres.ReturningInserted())
+		if err != nil {
+			return fmt.Errorf("merge stage table: %w", err)
+		}
+		if inserted, updated, err = scanInserted(queried); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	if stats != nil {
+		stats.add(int64(len(rows)), inserted, updated)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package upsert
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPgxCopyUpserterUpsert_StagesAndMerges(t *testing.T) {
+	conn := &fakePgxConn{returning: [][]bool{{true, false}}}
+	upserter := NewPgxCopyUpserter(conn)
+
+	var stats Stats
+	ctx := WithStats(context.Background(), &stats)
+	rows := [][]any{{int64(1), "John"}, {int64(2), "Jane"}}
+	if err := upserter.Upsert(ctx, "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	wantCalls := []string{
+		`exec: CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`,
+		`begin`,
+		`exec: CREATE TEMP TABLE "upsert_stage" ON COMMIT DROP AS SELECT "id", "name" FROM "users" WITH NO DATA`,
+		`copy: "upsert_stage" [id name]`,
+		`query: INSERT INTO "users" ("id", "name") SELECT "id", "name" FROM "upsert_stage" ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name" RETURNING (xmax = 0)`,
+		`commit`,
+	}
+	if !reflect.DeepEqual(conn.calls, wantCalls) {
+		t.Fatalf("calls = %#v, want %#v", conn.calls, wantCalls)
+	}
+	if want := []any{int64(1), "John", int64(2), "Jane"}; !reflect.DeepEqual(conn.args[3], want) {
+		t.Fatalf("copied = %#v, want %#v", conn.args[3], want)
+	}
+	if stats.Rows() != 2 || stats.Inserted() != 1 || stats.Updated() != 1 {
+		t.Fatalf("stats = rows %d inserted %d updated %d, want 2/1/1", stats.Rows(), stats.Inserted(), stats.Updated())
+	}
+}
+
+func TestPgxCopyUpserterUpsert_CopyErrorSkipsCommit(t *testing.T) {
+	conn := &fakePgxConn{failOn: `copy: "upsert_stage" [id]`}
+	upserter := NewPgxCopyUpserter(conn)
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{int64(1)}}, []string{"id"}); err == nil {
+		t.Fatal("expected copy error, got nil")
+	}
+	for _, call := range conn.calls {
+		if call == "commit" {
+			t.Fatalf("commit after failed copy: %v", conn.calls)
+		}
+	}
+}
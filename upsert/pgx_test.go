@@ -0,0 +1,141 @@
+package upsert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakePgxConn records what the pgx strategies send. Queries answer with the next entry
+// of returning, one boolean per row.
+type fakePgxConn struct {
+	calls     []string
+	args      [][]any
+	returning [][]bool
+	failOn    string
+}
+
+func (c *fakePgxConn) record(call string, args []any) error {
+	c.calls = append(c.calls, call)
+	c.args = append(c.args, args)
+	if c.failOn != "" && call == c.failOn {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func (c *fakePgxConn) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, c.record("exec: "+sql, args)
+}
+
+func (c *fakePgxConn) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := c.record("query: "+sql, args); err != nil {
+		return nil, err
+	}
+	return c.nextRows(), nil
+}
+
+func (c *fakePgxConn) nextRows() pgx.Rows {
+	var values []bool
+	if len(c.returning) > 0 {
+		values, c.returning = c.returning[0], c.returning[1:]
+	}
+	return &fakePgxRows{values: values}
+}
+
+func (c *fakePgxConn) SendBatch(_ context.Context, b *pgx.Batch) pgx.BatchResults {
+	return &fakeBatchResults{conn: c, queued: b.QueuedQueries}
+}
+
+func (c *fakePgxConn) Begin(context.Context) (pgx.Tx, error) {
+	if err := c.record("begin", nil); err != nil {
+		return nil, err
+	}
+	return &fakePgxTx{conn: c}, nil
+}
+
+type fakeBatchResults struct {
+	conn   *fakePgxConn
+	queued []*pgx.QueuedQuery
+	next   int
+}
+
+func (r *fakeBatchResults) pop() (*pgx.QueuedQuery, error) {
+	if r.next >= len(r.queued) {
+		return nil, errors.New("no more results")
+	}
+	q := r.queued[r.next]
+	r.next++
+	return q, r.conn.record("batch: "+q.SQL, q.Arguments)
+}
+
+func (r *fakeBatchResults) Exec() (pgconn.CommandTag, error) {
+	_, err := r.pop()
+	return pgconn.CommandTag{}, err
+}
+
+func (r *fakeBatchResults) Query() (pgx.Rows, error) {
+	if _, err := r.pop(); err != nil {
+		return nil, err
+	}
+	return r.conn.nextRows(), nil
+}
+
+func (r *fakeBatchResults) QueryRow() pgx.Row { panic("not used") }
+
+func (r *fakeBatchResults) Close() error { return nil }
+
+type fakePgxTx struct {
+	pgx.Tx
+	conn *fakePgxConn
+}
+
+func (t *fakePgxTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return t.conn.Exec(ctx, sql, args...)
+}
+
+func (t *fakePgxTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return t.conn.Query(ctx, sql, args...)
+}
+
+func (t *fakePgxTx) CopyFrom(_ context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	var copied []any
+	for src.Next() {
+		values, err := src.Values()
+		if err != nil {
+			return 0, err
+		}
+		copied = append(copied, values...)
+	}
+	if err := t.conn.record(fmt.Sprintf("copy: %s %v", table.Sanitize(), columns), copied); err != nil {
+		return 0, err
+	}
+	return int64(len(copied) / len(columns)), nil
+}
+
+func (t *fakePgxTx) Commit(context.Context) error { return t.conn.record("commit", nil) }
+
+func (t *fakePgxTx) Rollback(context.Context) error { return nil }
+
+type fakePgxRows struct {
+	pgx.Rows
+	values []bool
+	next   int
+}
+
+func (r *fakePgxRows) Next() bool {
+	r.next++
+	return r.next <= len(r.values)
+}
+
+func (r *fakePgxRows) Scan(dest ...any) error {
+	*dest[0].(*bool) = r.values[r.next-1]
+	return nil
+}
+
+func (r *fakePgxRows) Err() error { return nil }
+
+func (r *fakePgxRows) Close() {}
@@ -0,0 +1,104 @@
+package upsert
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// upsertPlan holds the validated, quoted pieces of a multi-row upsert.
+type upsertPlan struct {
+	dialect          Dialect
+	table            TableRef
+	tableIdent       string
+	quotedColumns    []string
+	quotedUniqueKeys []string
+	// updateColumns lists the quoted non-key columns an upsert overwrites.
+	updateColumns []string
+}
+
+// newUpsertPlan validates the arguments of an Upsert call the way HashIndexedUpserter
+// does: identifiers must be safe, unique keys must be columns, every row must match the
+// columns and no two rows may share unique key values.
+func newUpsertPlan(o options, table string, columns []string, rows [][]any, uniqueKeys []string) (upsertPlan, error) {
+	if len(columns) == 0 {
+		return upsertPlan{}, errors.New("at least one column is required")
+	}
+	if len(uniqueKeys) == 0 {
+		return upsertPlan{}, errors.New("at least one unique key is required")
+	}
+
+	plan := upsertPlan{dialect: o.dialect}
+	var err error
+	if plan.tableIdent, err = o.quoteTable(table); err != nil {
+		return upsertPlan{}, fmt.Errorf("table: %w", err)
+	}
+	if plan.table, err = ParseTableRef(table); err != nil {
+		return upsertPlan{}, fmt.Errorf("table: %w", err)
+	}
+
+	columnIndex := make(map[string]int, len(columns))
+	plan.quotedColumns = make([]string, len(columns))
+	for i, col := range columns {
+		quoted, err := o.quote(col)
+		if err != nil {
+			return upsertPlan{}, fmt.Errorf("column[%d]: %w", i, err)
+		}
+		plan.quotedColumns[i] = quoted
+		columnIndex[col] = i
+	}
+
+	uniqueSet := make(map[string]struct{}, len(uniqueKeys))
+	plan.quotedUniqueKeys = make([]string, len(uniqueKeys))
+	for i, key := range uniqueKeys {
+		idx, ok := columnIndex[key]
+		if !ok {
+			return upsertPlan{}, fmt.Errorf("unique key %q not found in columns", key)
+		}
+		plan.quotedUniqueKeys[i] = plan.quotedColumns[idx]
+		uniqueSet[key] = struct{}{}
+	}
+	for i, col := range columns {
+		if _, isUnique := uniqueSet[col]; !isUnique {
+			plan.updateColumns = append(plan.updateColumns, plan.quotedColumns[i])
+		}
+	}
+
+	seenKeys := make(map[string]int, len(rows))
+	for idx, row := range rows {
+		if len(row) != len(columns) {
+			return upsertPlan{}, fmt.Errorf("row %d: columns (%d) and values (%d) length mismatch", idx, len(columns), len(row))
+		}
+		key := compositeKey(row, uniqueKeys, columnIndex)
+		if prev, ok := seenKeys[key]; ok {
+			return upsertPlan{}, fmt.Errorf("rows %d and %d share duplicate unique key values", prev, idx)
+		}
+		seenKeys[key] = idx
+	}
+	return plan, nil
+}
+
+// insertValues returns a multi-row INSERT with placeholders for rowCount rows followed by
+// the dialect's upsert clause.
+func (p upsertPlan) insertValues(rowCount int) string {
+	return p.insertRows(rowCount) + " " + p.dialect.UpsertClause(p.quotedUniqueKeys, p.updateColumns)
+}
+
+// insertRows returns a plain multi-row INSERT with placeholders for rowCount rows.
+func (p upsertPlan) insertRows(rowCount int) string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		p.tableIdent,
+		strings.Join(p.quotedColumns, ", "),
+		strings.Join(placeholderRows(p.dialect, len(p.quotedColumns), rowCount), "), ("),
+	)
+}
+
+// uniqueIndexStatement returns the dialect's DDL for the index the hash strategies rely on.
+func (p upsertPlan) uniqueIndexStatement(uniqueKeys []string) (string, error) {
+	indexIdent, err := p.dialect.QuoteIdentifier(deriveIndexName(p.table, uniqueKeys, "hash_idx"))
+	if err != nil {
+		return "", fmt.Errorf("index name: %w", err)
+	}
+	return p.dialect.CreateUniqueIndex(indexIdent, p.tableIdent, p.quotedUniqueKeys), nil
+}
@@ -0,0 +1,194 @@
+package upsert
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress describes how far a load has come.
+type Progress struct {
+	Table string
+	// Rows and Batches count the rows and batches committed so far. TotalRows is 0 when
+	// the size of the load is unknown.
+	Rows      int64
+	TotalRows int64
+	Batches   int
+	// BatchRows is the size of the batch that triggered this report.
+	BatchRows int
+	Elapsed   time.Duration
+	// Throughput is a moving average of recent batches in rows per second.
+	Throughput float64
+	// ETA estimates the time left, or is 0 when TotalRows is unknown.
+	ETA time.Duration
+}
+
+// OnProgress calls report after every committed batch of an Upsert call, with the call's
+// rows as the total. Strategies without batches report once per call. report runs on the
+// calling goroutine, so it should return quickly. To follow a load spread over many
+// calls, feed the reports' BatchRows to a ProgressMeter.
+func OnProgress(report func(Progress)) Option {
+	return func(o *options) {
+		o.progress = report
+	}
+}
+
+// throughputSmoothing weights the latest batch in the Throughput moving average.
+const throughputSmoothing = 0.3
+
+// ProgressMeter turns finished batches into Progress reports. It is safe for concurrent use.
+type ProgressMeter struct {
+	table  string
+	total  int64
+	report func(Progress)
+
+	mu        sync.Mutex
+	start     time.Time
+	last      time.Time
+	rows      int64
+	batches   int
+	rate      float64
+	lastBatch int
+}
+
+// NewProgressMeter returns a meter for a load of total rows into table, reporting each
+// batch to report; total may be 0 when unknown.
+func NewProgressMeter(table string, total int64, report func(Progress)) *ProgressMeter {
+	now := time.Now()
+	return &ProgressMeter{table: table, total: total, report: report, start: now, last: now}
+}
+
+// Skip counts rows committed before the meter started, such as a resumed job's, without
+// letting them inflate the throughput.
+func (m *ProgressMeter) Skip(rows int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows += int64(rows)
+}
+
+// Add records a committed batch of rows and reports the new progress.
+func (m *ProgressMeter) Add(rows int) {
+	m.mu.Lock()
+	now := time.Now()
+	if elapsed := now.Sub(m.last).Seconds(); elapsed > 0 {
+		rate := float64(rows) / elapsed
+		if m.batches == 0 {
+			m.rate = rate
+		} else {
+			m.rate = throughputSmoothing*rate + (1-throughputSmoothing)*m.rate
+		}
+	}
+	m.last = now
+	m.rows += int64(rows)
+	m.batches++
+	m.lastBatch = rows
+	p := m.progressLocked(now)
+	m.mu.Unlock()
+
+	if m.report != nil {
+		m.report(p)
+	}
+}
+
+// Progress returns the progress so far.
+func (m *ProgressMeter) Progress() Progress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.progressLocked(time.Now())
+}
+
+func (m *ProgressMeter) progressLocked(now time.Time) Progress {
+	p := Progress{
+		Table:      m.table,
+		Rows:       m.rows,
+		TotalRows:  m.total,
+		Batches:    m.batches,
+		BatchRows:  m.lastBatch,
+		Elapsed:    now.Sub(m.start),
+		Throughput: m.rate,
+	}
+	if m.total > 0 && m.rate > 0 && m.rows < m.total {
+		p.ETA = time.Duration(float64(m.total-m.rows) / m.rate * float64(time.Second))
+	}
+	return p
+}
+
+type progressKey struct{}
+
+// startProgress attaches a meter for one call of rows to ctx when OnProgress is set.
+func (o options) startProgress(ctx context.Context, table string, rows int) context.Context {
+	if o.progress == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, NewProgressMeter(table, int64(rows), o.progress))
+}
+
+// progressFromContext returns the call's meter, or nil.
+func progressFromContext(ctx context.Context) *ProgressMeter {
+	meter, _ := ctx.Value(progressKey{}).(*ProgressMeter)
+	return meter
+}
+
+// ProgressLine renders Progress as a single terminal line, redrawn in place with a
+// carriage return and at most every Interval.
+type ProgressLine struct {
+	w        io.Writer
+	Interval time.Duration
+
+	mu    sync.Mutex
+	drawn time.Time
+	width int
+}
+
+func NewProgressLine(w io.Writer) *ProgressLine {
+	return &ProgressLine{w: w, Interval: 200 * time.Millisecond}
+}
+
+// Render redraws the line, unless it was drawn less than Interval ago and the load is
+// not done yet.
+func (l *ProgressLine) Render(p Progress) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	done := p.TotalRows > 0 && p.Rows >= p.TotalRows
+	if !done && time.Since(l.drawn) < l.Interval {
+		return
+	}
+	l.drawn = time.Now()
+
+	line := FormatProgress(p)
+	pad := max(0, l.width-len(line))
+	l.width = len(line)
+	fmt.Fprintf(l.w, "\r%s%s", line, strings.Repeat(" ", pad))
+}
+
+// Finish ends the line so later output starts on a new one.
+func (l *ProgressLine) Finish() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.width > 0 {
+		fmt.Fprintln(l.w)
+		l.width = 0
+	}
+}
+
+// FormatProgress renders p as one line, such as
+// "users: 12000/50000 rows (24.0%), 30 batches, 3100 rows/s, elapsed 4s, ETA 12s".
+func FormatProgress(p Progress) string {
+	var b strings.Builder
+	if p.Table != "" {
+		fmt.Fprintf(&b, "%s: ", p.Table)
+	}
+	if p.TotalRows > 0 {
+		fmt.Fprintf(&b, "%d/%d rows (%.1f%%)", p.Rows, p.TotalRows, 100*float64(p.Rows)/float64(p.TotalRows))
+	} else {
+		fmt.Fprintf(&b, "%d rows", p.Rows)
+	}
+	fmt.Fprintf(&b, ", %d batches, %.0f rows/s, elapsed %s", p.Batches, p.Throughput, p.Elapsed.Round(time.Second))
+	if p.ETA > 0 {
+		fmt.Fprintf(&b, ", ETA %s", p.ETA.Round(time.Second))
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package upsert
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestOnProgress_BatchedHashIndexed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	var reports []Progress
+	upserter := NewBatchedHashIndexedUpserter(db, OnProgress(func(p Progress) { reports = append(reports, p) })).(*BatchedHashIndexedUpserter).WithBatchSize(2)
+
+	for range 2 {
+		mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users"`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	rows := [][]any{{int64(1)}, {int64(2)}, {int64(3)}}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	if len(reports) != 2 {
+		t.Fatalf("reports = %+v, want one per batch", reports)
+	}
+	first, last := reports[0], reports[1]
+	if first.Rows != 2 || first.BatchRows != 2 || first.TotalRows != 3 || first.Batches != 1 || first.Table != "users" {
+		t.Fatalf("first report = %+v", first)
+	}
+	if last.Rows != 3 || last.BatchRows != 1 || last.Batches != 2 || last.ETA != 0 {
+		t.Fatalf("last report = %+v", last)
+	}
+}
+
+func TestProgressMeter(t *testing.T) {
+	var got Progress
+	meter := NewProgressMeter("users", 100, func(p Progress) { got = p })
+	meter.Skip(20)
+	time.Sleep(time.Millisecond)
+	meter.Add(30)
+
+	if got.Rows != 50 || got.Batches != 1 || got.BatchRows != 30 {
+		t.Fatalf("progress = %+v, want 50 rows after one batch", got)
+	}
+	if got.Throughput <= 0 || got.ETA <= 0 {
+		t.Fatalf("progress = %+v, want positive throughput and ETA", got)
+	}
+
+	unknown := NewProgressMeter("users", 0, nil)
+	unknown.Add(10)
+	if p := unknown.Progress(); p.ETA != 0 || p.Rows != 10 {
+		t.Fatalf("progress without total = %+v, want no ETA", p)
+	}
+}
+
+func TestFormatProgress(t *testing.T) {
+	p := Progress{Table: "users", Rows: 12000, TotalRows: 50000, Batches: 24, Throughput: 3000, Elapsed: 4 * time.Second, ETA: 12700 * time.Millisecond}
+	if got, want := FormatProgress(p), "users: 12000/50000 rows (24.0%), 24 batches, 3000 rows/s, elapsed 4s, ETA 13s"; got != want {
+		t.Fatalf("FormatProgress() = %q, want %q", got, want)
+	}
+	p.TotalRows, p.ETA = 0, 0
+	if got, want := FormatProgress(p), "users: 12000 rows, 24 batches, 3000 rows/s, elapsed 4s"; got != want {
+		t.Fatalf("FormatProgress() = %q, want %q", got, want)
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	var buf bytes.Buffer
+	line := NewProgressLine(&buf)
+	line.Interval = time.Hour
+
+	first := Progress{Table: "a_rather_long_table_name", Rows: 100000, Batches: 2}
+	line.Render(first)
+	line.Render(Progress{Rows: 100500, Batches: 3}) // throttled
+	line.Render(Progress{Rows: 5, TotalRows: 5, Batches: 4})
+	line.Finish()
+
+	out := buf.String()
+	if strings.Count(out, "\r") != 2 || !strings.HasSuffix(out, "\n") {
+		t.Fatalf("output = %q, want two redraws and a final newline", out)
+	}
+	if strings.Contains(out, "100500") {
+		t.Fatalf("output = %q, want the second render throttled", out)
+	}
+	// The shorter final line pads over the previous one.
+	if last := out[strings.LastIndex(out, "\r")+1 : len(out)-1]; len(last) != len(FormatProgress(first)) {
+		t.Fatalf("final line %q was not padded", last)
+	}
+}
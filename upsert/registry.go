@@ -0,0 +1,131 @@
+package upsert
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// StrategyConfig holds what a registered strategy may need to build an Upserter.
+// Strategies ignore the fields they have no use for.
+type StrategyConfig struct {
+	// DB is the database for the database/sql strategies.
+	DB *sql.DB
+	// Pgx is the connection or pool for the pgx strategies.
+	Pgx PgxConn
+	// BatchSize is the number of rows per statement for batched strategies; 0 keeps the
+	// strategy's default.
+	BatchSize int
+	// Options configure the database/sql strategies. The pgx strategies take none and
+	// fail if any are given.
+	Options []Option
+}
+
+// Factory builds an Upserter from a StrategyConfig.
+type Factory func(cfg StrategyConfig) (Upserter, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register("naive", func(cfg StrategyConfig) (Upserter, error) {
+		if cfg.DB == nil {
+			return nil, errors.New("naive: a *sql.DB is required")
+		}
+		return NewNaiveUpserter(cfg.DB, cfg.Options...), nil
+	})
+	Register("hash", func(cfg StrategyConfig) (Upserter, error) {
+		if cfg.DB == nil {
+			return nil, errors.New("hash: a *sql.DB is required")
+		}
+		return NewHashIndexedUpserter(cfg.DB, cfg.Options...), nil
+	})
+	Register("batched", func(cfg StrategyConfig) (Upserter, error) {
+		if cfg.DB == nil {
+			return nil, errors.New("batched: a *sql.DB is required")
+		}
+		u := NewBatchedHashIndexedUpserter(cfg.DB, cfg.Options...).(*BatchedHashIndexedUpserter)
+		if cfg.BatchSize == 0 {
+			return u, nil
+		}
+		return u.WithBatchSize(cfg.BatchSize), nil
+	})
+	Register("batched-naive", func(cfg StrategyConfig) (Upserter, error) {
+		if cfg.DB == nil {
+			return nil, errors.New("batched-naive: a *sql.DB is required")
+		}
+		u := NewBatchedNaiveUpserter(cfg.DB, cfg.Options...).(*BatchedNaiveUpserter)
+		if cfg.BatchSize == 0 {
+			return u, nil
+		}
+		return u.WithBatchSize(cfg.BatchSize), nil
+	})
+	Register("auto", func(cfg StrategyConfig) (Upserter, error) {
+		if cfg.DB == nil {
+			return nil, errors.New("auto: a *sql.DB is required")
+		}
+		return NewAutoUpserter(cfg.DB, cfg.Options...), nil
+	})
+	Register("pgx-batch", func(cfg StrategyConfig) (Upserter, error) {
+		if cfg.Pgx == nil {
+			return nil, errors.New("pgx-batch: a pgx connection is required")
+		}
+		if len(cfg.Options) > 0 {
+			return nil, errors.New("pgx-batch: options are not supported")
+		}
+		return NewPgxBatchUpserter(cfg.Pgx), nil
+	})
+	Register("pgx-copy", func(cfg StrategyConfig) (Upserter, error) {
+		if cfg.Pgx == nil {
+			return nil, errors.New("pgx-copy: a pgx connection is required")
+		}
+		if len(cfg.Options) > 0 {
+			return nil, errors.New("pgx-copy: options are not supported")
+		}
+		return NewPgxCopyUpserter(cfg.Pgx), nil
+	})
+}
+
+// Register makes a strategy available to New under name. Like database/sql.Register,
+// it panics if name is empty, f is nil or name is already registered.
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if name == "" || f == nil {
+		panic("upsert: Register needs a name and a factory")
+	}
+	if _, dup := registry[name]; dup {
+		panic("upsert: Register called twice for strategy " + name)
+	}
+	registry[name] = f
+}
+
+// New builds the strategy registered under name.
+func New(name string, cfg StrategyConfig) (Upserter, error) {
+	if cfg.BatchSize < 0 {
+		return nil, fmt.Errorf("batch size must not be negative, got %d", cfg.BatchSize)
+	}
+	registryMu.RLock()
+	f, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q (registered: %v)", name, Strategies())
+	}
+	return f(cfg)
+}
+
+// Strategies returns the names of the registered strategies in sorted order.
+func Strategies() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,122 @@
+package upsert
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestStrategies_BuiltIn(t *testing.T) {
+	got := Strategies()
+	for _, name := range []string{"auto", "batched", "batched-naive", "hash", "naive", "pgx-batch", "pgx-copy"} {
+		if !slices.Contains(got, name) {
+			t.Fatalf("Strategies() = %v, missing %q", got, name)
+		}
+	}
+	if !slices.IsSorted(got) {
+		t.Fatalf("Strategies() = %v, not sorted", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name string
+		cfg  StrategyConfig
+		want reflect.Type
+	}{
+		{"naive", StrategyConfig{DB: db}, reflect.TypeOf(&NaiveUpserter{})},
+		{"hash", StrategyConfig{DB: db}, reflect.TypeOf(&HashIndexedUpserter{})},
+		{"batched", StrategyConfig{DB: db, BatchSize: 64}, reflect.TypeOf(&BatchedHashIndexedUpserter{})},
+		{"batched-naive", StrategyConfig{DB: db}, reflect.TypeOf(&BatchedNaiveUpserter{})},
+		{"auto", StrategyConfig{DB: db}, reflect.TypeOf(&AutoUpserter{})},
+		{"pgx-batch", StrategyConfig{Pgx: &fakePgxConn{}}, reflect.TypeOf(&PgxBatchUpserter{})},
+		{"pgx-copy", StrategyConfig{Pgx: &fakePgxConn{}}, reflect.TypeOf(&PgxCopyUpserter{})},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := New(tc.name, tc.cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if got := reflect.TypeOf(u); got != tc.want {
+				t.Fatalf("New(%q) = %v, want %v", tc.name, got, tc.want)
+			}
+		})
+	}
+
+	u, _ := New("batched", StrategyConfig{DB: db, BatchSize: 64})
+	if got := u.(*BatchedHashIndexedUpserter).batchSize; got != 64 {
+		t.Fatalf("batch size = %d, want 64", got)
+	}
+	u, _ = New("batched", StrategyConfig{DB: db})
+	if got := u.(*BatchedHashIndexedUpserter).batchSize; got != 500 {
+		t.Fatalf("default batch size = %d, want 500", got)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name     string
+		strategy string
+		cfg      StrategyConfig
+	}{
+		{"unknown", "bulk", StrategyConfig{DB: db}},
+		{"missingDB", "hash", StrategyConfig{}},
+		{"missingPgx", "pgx-copy", StrategyConfig{DB: db}},
+		{"negativeBatchSize", "batched", StrategyConfig{DB: db, BatchSize: -1}},
+		{"pgxBatchOptions", "pgx-batch", StrategyConfig{Pgx: &fakePgxConn{}, Options: []Option{WithDialect(Postgres)}}},
+		{"pgxCopyOptions", "pgx-copy", StrategyConfig{Pgx: &fakePgxConn{}, Options: []Option{WithDialect(Postgres)}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := New(tc.strategy, tc.cfg); err == nil {
+				t.Fatalf("New(%q) expected error, got nil", tc.strategy)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var called bool
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "test-register")
+		registryMu.Unlock()
+	})
+	Register("test-register", func(cfg StrategyConfig) (Upserter, error) {
+		return UpserterFunc(func(context.Context, string, []string, [][]any, []string) error {
+			called = true
+			return nil
+		}), nil
+	})
+
+	u, err := New("test-register", StrategyConfig{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := u.Upsert(context.Background(), "users", nil, nil, nil); err != nil || !called {
+		t.Fatalf("registered strategy not used: called=%v err=%v", called, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate Register did not panic")
+		}
+	}()
+	Register("test-register", func(StrategyConfig) (Upserter, error) { return nil, nil })
+}
@@ -0,0 +1,216 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStrategies builds every strategy against a SQLite database.
+var sqliteStrategies = []struct {
+	name string
+	new  func(db *sql.DB) Upserter
+}{
+	{"Naive", func(db *sql.DB) Upserter { return NewNaiveUpserter(db, WithDialect(SQLite)) }},
+	{"HashIndexed", func(db *sql.DB) Upserter { return NewHashIndexedUpserter(db, WithDialect(SQLite)) }},
+	{"BatchedHashIndexed", func(db *sql.DB) Upserter {
+		return NewBatchedHashIndexedUpserter(db, WithDialect(SQLite)).(*BatchedHashIndexedUpserter).WithBatchSize(2)
+	}},
+	{"BatchedNaive", func(db *sql.DB) Upserter {
+		return NewBatchedNaiveUpserter(db, WithDialect(SQLite)).(*BatchedNaiveUpserter).WithBatchSize(2)
+	}},
+	{"NaiveCached", func(db *sql.DB) Upserter {
+		return NewNaiveUpserter(db, WithDialect(SQLite), WithStatementCache(NewStatementCache(4)))
+	}},
+	{"BatchedHashIndexedCached", func(db *sql.DB) Upserter {
+		return NewBatchedHashIndexedUpserter(db, WithDialect(SQLite), WithStatementCache(NewStatementCache(4))).(*BatchedHashIndexedUpserter).WithBatchSize(2)
+	}},
+}
+
+func openSQLite(t *testing.T, schema string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "upsert.db"))
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// A single connection keeps transactions from contending for the database lock.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	return db
+}
+
+func queryRows(t *testing.T, db *sql.DB, query string) [][]any {
+	t.Helper()
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("columns: %v", err)
+	}
+	var out [][]any
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		out = append(out, values)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows: %v", err)
+	}
+	return out
+}
+
+func TestSQLiteUpserters(t *testing.T) {
+	tests := []struct {
+		name       string
+		table      string
+		schema     string
+		seed       string
+		columns    []string
+		rows       [][]any
+		uniqueKeys []string
+		query      string
+		want       [][]any
+	}{
+		{
+			name:       "insert into empty table",
+			table:      "users",
+			schema:     `CREATE TABLE users (id INTEGER NOT NULL, name TEXT NOT NULL)`,
+			columns:    []string{"id", "name"},
+			rows:       [][]any{{int64(1), "John"}, {int64(2), "Jane"}, {int64(3), "Joe"}},
+			uniqueKeys: []string{"id"},
+			query:      `SELECT id, name FROM users ORDER BY id`,
+			want:       [][]any{{int64(1), "John"}, {int64(2), "Jane"}, {int64(3), "Joe"}},
+		},
+		{
+			name:       "update existing rows",
+			table:      "users",
+			schema:     `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT)`,
+			seed:       `INSERT INTO users VALUES (1, 'old', 'old@example.com'), (3, 'keep', 'keep@example.com')`,
+			columns:    []string{"id", "name", "email"},
+			rows:       [][]any{{int64(1), "John", nil}, {int64(2), "Jane", "jane@example.com"}},
+			uniqueKeys: []string{"id"},
+			query:      `SELECT id, name, email FROM users ORDER BY id`,
+			want: [][]any{
+				{int64(1), "John", nil},
+				{int64(2), "Jane", "jane@example.com"},
+				{int64(3), "keep", "keep@example.com"},
+			},
+		},
+		{
+			name:       "composite key",
+			table:      "memberships",
+			schema:     `CREATE TABLE memberships (tenant TEXT NOT NULL, user_id INTEGER NOT NULL, role TEXT NOT NULL)`,
+			seed:       `INSERT INTO memberships VALUES ('acme', 1, 'member'), ('globex', 1, 'member')`,
+			columns:    []string{"tenant", "user_id", "role"},
+			rows:       [][]any{{"acme", int64(1), "admin"}, {"acme", int64(2), "member"}},
+			uniqueKeys: []string{"tenant", "user_id"},
+			query:      `SELECT tenant, user_id, role FROM memberships ORDER BY tenant, user_id`,
+			want: [][]any{
+				{"acme", int64(1), "admin"},
+				{"acme", int64(2), "member"},
+				{"globex", int64(1), "member"},
+			},
+		},
+		{
+			name:       "all columns are keys",
+			table:      "tags",
+			schema:     `CREATE TABLE tags (name TEXT NOT NULL)`,
+			seed:       `INSERT INTO tags VALUES ('go')`,
+			columns:    []string{"name"},
+			rows:       [][]any{{"go"}, {"sql"}},
+			uniqueKeys: []string{"name"},
+			query:      `SELECT name FROM tags ORDER BY name`,
+			want:       [][]any{{"go"}, {"sql"}},
+		},
+	}
+
+	for _, strategy := range sqliteStrategies {
+		for _, tt := range tests {
+			t.Run(strategy.name+"/"+tt.name, func(t *testing.T) {
+				db := openSQLite(t, tt.schema)
+				if tt.seed != "" {
+					if _, err := db.Exec(tt.seed); err != nil {
+						t.Fatalf("seed: %v", err)
+					}
+				}
+
+				var stats Stats
+				ctx := WithStats(context.Background(), &stats)
+				if err := strategy.new(db).Upsert(ctx, tt.table, tt.columns, tt.rows, tt.uniqueKeys); err != nil {
+					t.Fatalf("Upsert: %v", err)
+				}
+				if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("rows = %v, want %v", got, tt.want)
+				}
+				if stats.Rows() != int64(len(tt.rows)) {
+					t.Fatalf("stats.Rows() = %d, want %d", stats.Rows(), len(tt.rows))
+				}
+			})
+		}
+	}
+}
+
+func TestSQLiteUpserters_PlaceholderLimit(t *testing.T) {
+	const count = 12000 // 3 columns × 12000 rows exceeds SQLite's 32766 bind parameters.
+	rows := make([][]any, count)
+	for i := range rows {
+		rows[i] = []any{int64(i + 1), fmt.Sprintf("name-%d", i+1), fmt.Sprintf("user%d@example.com", i+1)}
+	}
+	columns := []string{"id", "name", "email"}
+	schema := `CREATE TABLE users (id INTEGER NOT NULL, name TEXT NOT NULL, email TEXT NOT NULL)`
+
+	db := openSQLite(t, schema)
+	if err := NewHashIndexedUpserter(db, WithDialect(SQLite)).Upsert(context.Background(), "users", columns, rows, []string{"id"}); err == nil {
+		t.Fatal("expected bind parameter limit error, got nil")
+	}
+
+	db = openSQLite(t, schema)
+	if err := NewBatchedHashIndexedUpserter(db, WithDialect(SQLite)).(*BatchedHashIndexedUpserter).WithBatchSize(count).Upsert(context.Background(), "users", columns, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if got := queryRows(t, db, `SELECT count(*) FROM users`); got[0][0] != int64(count) {
+		t.Fatalf("count = %v, want %d", got[0][0], count)
+	}
+}
+
+// TestSQLiteBatchedNaive_KeyRepresentation upserts a key that the database considers
+// equal to a stored one but that renders differently; the table has no unique index, so
+// treating it as new would insert a duplicate.
+func TestSQLiteBatchedNaive_KeyRepresentation(t *testing.T) {
+	db := openSQLite(t, `CREATE TABLE users (email TEXT COLLATE NOCASE, name TEXT);
+INSERT INTO users VALUES ('john@example.com', 'John');`)
+
+	upserter := NewBatchedNaiveUpserter(db, WithDialect(SQLite))
+	var stats Stats
+	rows := [][]any{{"John@Example.com", "Johnny"}, {"jane@example.com", "Jane"}}
+	if err := upserter.Upsert(WithStats(context.Background(), &stats), "users", []string{"email", "name"}, rows, []string{"email"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	got := queryRows(t, db, `SELECT email, name FROM users ORDER BY email`)
+	want := [][]any{{"jane@example.com", "Jane"}, {"john@example.com", "Johnny"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rows = %v, want %v", got, want)
+	}
+	if stats.Inserted() != 1 || stats.Updated() != 1 {
+		t.Fatalf("stats = inserted %d updated %d, want 1/1", stats.Inserted(), stats.Updated())
+	}
+}
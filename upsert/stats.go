@@ -0,0 +1,43 @@
+package upsert
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Stats counts the rows written by upserts. Attach one to a context with WithStats
+// and every strategy called with that context adds to it as statements succeed.
+type Stats struct {
+	rows     atomic.Int64
+	inserted atomic.Int64
+	updated  atomic.Int64
+}
+
+// Rows returns the number of rows sent to the database.
+func (s *Stats) Rows() int64 { return s.rows.Load() }
+
+// Inserted returns the number of rows that did not exist before. Inserted and Updated
+// stay zero for strategies or dialects that cannot tell inserts from updates.
+func (s *Stats) Inserted() int64 { return s.inserted.Load() }
+
+// Updated returns the number of rows that matched an existing unique key.
+func (s *Stats) Updated() int64 { return s.updated.Load() }
+
+func (s *Stats) add(rows, inserted, updated int64) {
+	s.rows.Add(rows)
+	s.inserted.Add(inserted)
+	s.updated.Add(updated)
+}
+
+type statsKey struct{}
+
+// WithStats returns a context that records upsert counts into stats.
+func WithStats(ctx context.Context, stats *Stats) context.Context {
+	return context.WithValue(ctx, statsKey{}, stats)
+}
+
+// statsFromContext returns the Stats attached to ctx, or nil.
+func statsFromContext(ctx context.Context) *Stats {
+	stats, _ := ctx.Value(statsKey{}).(*Stats)
+	return stats
+}
@@ -0,0 +1,266 @@
+package upsert
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// statementKey identifies the shape of a generated statement: the same key always
+// produces the same SQL text.
+type statementKey struct {
+	db      *sql.DB
+	table   string
+	columns string
+	keys    string
+	rows    int
+	// policy names the kind of statement, such as "upsert" or "update".
+	policy string
+}
+
+func newStatementKey(db *sql.DB, table string, columns, uniqueKeys []string, rows int, policy string) statementKey {
+	return statementKey{
+		db:      db,
+		table:   table,
+		columns: strings.Join(columns, "\x00"),
+		keys:    strings.Join(uniqueKeys, "\x00"),
+		rows:    rows,
+		policy:  policy,
+	}
+}
+
+// StatementCache keeps prepared statements for repeated statement shapes so that, for
+// example, every full batch of BatchedHashIndexedUpserter reuses one prepared plan.
+// database/sql prepares a cached statement once per connection it runs on, and
+// transactions reuse the connection's copy. Beyond its capacity the least recently used
+// statement is closed. A StatementCache is safe for concurrent use and may be shared by
+// upserters.
+type StatementCache struct {
+	mu       sync.Mutex
+	capacity int
+	// order holds *cachedStatement values, most recently used first.
+	order   *list.List
+	entries map[statementKey]*list.Element
+}
+
+type cachedStatement struct {
+	key  statementKey
+	stmt *sql.Stmt
+	// refs counts callers currently using stmt; an evicted statement is closed once
+	// the last of them releases it.
+	refs    int
+	evicted bool
+}
+
+// NewStatementCache returns a cache holding up to capacity prepared statements.
+func NewStatementCache(capacity int) *StatementCache {
+	return &StatementCache{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		entries:  make(map[statementKey]*list.Element),
+	}
+}
+
+// Len returns the number of cached statements.
+func (c *StatementCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Invalidate closes every cached statement for table. Upserters call it when a
+// statement fails because the table changed shape; call it after altering a table.
+func (c *StatementCache) Invalidate(table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if entry := el.Value.(*cachedStatement); entry.key.table == table {
+			c.evictLocked(el)
+		}
+		el = next
+	}
+}
+
+// Close closes all cached statements.
+func (c *StatementCache) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		c.evictLocked(el)
+	}
+}
+
+// acquire returns the cached statement for key, preparing build() on a miss. The caller
+// must release it when done.
+func (c *StatementCache) acquire(ctx context.Context, key statementKey, build func() string) (*cachedStatement, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		entry := el.Value.(*cachedStatement)
+		entry.refs++
+		c.mu.Unlock()
+		return entry, nil
+	}
+	c.mu.Unlock()
+
+	stmt, err := key.db.PrepareContext(ctx, build())
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		// Another caller prepared the same statement meanwhile; keep theirs.
+		_ = stmt.Close()
+		c.order.MoveToFront(el)
+		entry := el.Value.(*cachedStatement)
+		entry.refs++
+		return entry, nil
+	}
+	entry := &cachedStatement{key: key, stmt: stmt, refs: 1}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.capacity {
+		c.evictLocked(c.order.Back())
+	}
+	return entry, nil
+}
+
+func (c *StatementCache) release(entry *cachedStatement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		_ = entry.stmt.Close()
+	}
+}
+
+func (c *StatementCache) evictLocked(el *list.Element) {
+	entry := c.order.Remove(el).(*cachedStatement)
+	delete(c.entries, entry.key)
+	entry.evicted = true
+	if entry.refs == 0 {
+		_ = entry.stmt.Close()
+	}
+}
+
+// isSchemaChange reports whether err means a prepared statement no longer matches the
+// table it was prepared against.
+func isSchemaChange(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		switch state.SQLState() {
+		case "42P01", "42703": // undefined_table, undefined_column
+			return true
+		}
+	}
+	return strings.Contains(err.Error(), "cached plan must not change result type")
+}
+
+// preparedStatement is a statement ready to run on the database or inside a
+// transaction: a cached prepared statement, or plain SQL text without a cache.
+type preparedStatement struct {
+	opts  options
+	cache *StatementCache
+	key   statementKey
+	build func() string
+	entry *cachedStatement
+	query string
+}
+
+// prepare returns the statement for key. With a statement cache it is acquired from the
+// cache, preparing build() on a miss; callers running it inside a transaction must
+// prepare before beginning it, since preparing takes a connection of its own. release
+// must be called when done.
+func (o options) prepare(ctx context.Context, key statementKey, build func() string) (*preparedStatement, error) {
+	if o.statements == nil {
+		return &preparedStatement{opts: o, query: build()}, nil
+	}
+	entry, err := o.statements.acquire(ctx, key, build)
+	if err != nil {
+		return nil, err
+	}
+	return &preparedStatement{opts: o, cache: o.statements, key: key, build: build, entry: entry}, nil
+}
+
+func (p *preparedStatement) release() {
+	if p.entry != nil {
+		p.cache.release(p.entry)
+		p.entry = nil
+	}
+}
+
+func (p *preparedStatement) exec(ctx context.Context, db *sql.DB, tx *sql.Tx, args ...any) (sql.Result, error) {
+	p.logStatement(ctx, args)
+	if p.cache == nil {
+		if tx != nil {
+			return tx.ExecContext(ctx, p.query, args...)
+		}
+		return db.ExecContext(ctx, p.query, args...)
+	}
+	return runPrepared(ctx, p, tx, func(stmt *sql.Stmt) (sql.Result, error) {
+		return stmt.ExecContext(ctx, args...)
+	})
+}
+
+func (p *preparedStatement) queryRows(ctx context.Context, db *sql.DB, tx *sql.Tx, args ...any) (*sql.Rows, error) {
+	p.logStatement(ctx, args)
+	if p.cache == nil {
+		if tx != nil {
+			return tx.QueryContext(ctx, p.query, args...)
+		}
+		return db.QueryContext(ctx, p.query, args...)
+	}
+	return runPrepared(ctx, p, tx, func(stmt *sql.Stmt) (*sql.Rows, error) {
+		return stmt.QueryContext(ctx, args...)
+	})
+}
+
+// logStatement logs the statement's SQL; building it again for a cached statement is
+// skipped unless Debug logging is on.
+func (p *preparedStatement) logStatement(ctx context.Context, args []any) {
+	if !p.opts.log().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	query := p.query
+	if p.cache != nil {
+		query = p.build()
+	}
+	p.opts.logStatement(ctx, query, args)
+}
+
+// runPrepared runs fn with the cached statement, bound to tx when tx is not nil. A
+// statement failing because its table changed shape is evicted; outside a transaction it
+// is prepared again and retried once. Inside one the error is returned, since PostgreSQL
+// has aborted the transaction.
+func runPrepared[T any](ctx context.Context, p *preparedStatement, tx *sql.Tx, fn func(*sql.Stmt) (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		stmt := p.entry.stmt
+		if tx != nil {
+			stmt = tx.StmtContext(ctx, stmt)
+		}
+		result, err := fn(stmt)
+		if tx != nil {
+			_ = stmt.Close()
+		}
+		if err == nil || !isSchemaChange(err) {
+			return result, err
+		}
+
+		p.cache.Invalidate(p.key.table)
+		if tx != nil || attempt > 0 {
+			return result, err
+		}
+		p.opts.log().LogAttrs(ctx, slog.LevelWarn, "upsert statement re-prepared after schema change",
+			slog.String("table", p.key.table), slog.Any("error", err))
+		p.release()
+		if p.entry, err = p.cache.acquire(ctx, p.key, p.build); err != nil {
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package upsert
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+const cachedUpsertIndex = `CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`
+
+func TestStatementCache_ReusesPreparedStatement(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	cache := NewStatementCache(8)
+	upserter := NewBatchedHashIndexedUpserter(db, WithStatementCache(cache)).(*BatchedHashIndexedUpserter).WithBatchSize(2)
+
+	mock.ExpectExec(regexp.QuoteMeta(cachedUpsertIndex)).WillReturnResult(sqlmock.NewResult(0, 0))
+	full := mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`))
+	full.ExpectExec().WithArgs(int64(1), "a", int64(2), "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(cachedUpsertIndex)).WillReturnResult(sqlmock.NewResult(0, 0))
+	full.ExpectExec().WithArgs(int64(3), "c", int64(4), "d").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(cachedUpsertIndex)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare(regexp.QuoteMeta(`INSERT INTO "users" ("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`)).
+		ExpectExec().WithArgs(int64(5), "e").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rows := [][]any{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}, {int64(4), "d"}, {int64(5), "e"}}
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("cache.Len() = %d, want 2", cache.Len())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStatementCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	cache := NewStatementCache(1)
+	mock.ExpectPrepare("SELECT 1").WillBeClosed()
+	mock.ExpectPrepare("SELECT 2")
+
+	ctx := context.Background()
+	first, err := cache.acquire(ctx, statementKey{db: db, table: "a"}, func() string { return "SELECT 1" })
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	second, err := cache.acquire(ctx, statementKey{db: db, table: "b"}, func() string { return "SELECT 2" })
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if cache.Len() != 1 {
+		t.Fatalf("cache.Len() = %d, want 1", cache.Len())
+	}
+	if err := mock.ExpectationsWereMet(); err == nil {
+		t.Fatal("evicted statement closed while still in use")
+	}
+
+	cache.release(first)
+	cache.release(second)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStatementCache_RepreparesAfterSchemaChange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	cache := NewStatementCache(8)
+	upserter := NewHashIndexedUpserter(db, WithStatementCache(cache))
+	query := regexp.QuoteMeta(`INSERT INTO "users" ("id") VALUES ($1) ON CONFLICT ("id") DO NOTHING`)
+
+	mock.ExpectExec(regexp.QuoteMeta(cachedUpsertIndex)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare(query).WillBeClosed().
+		ExpectExec().WithArgs(int64(1)).
+		WillReturnError(&pq.Error{Code: "0A000", Message: "cached plan must not change result type"})
+	mock.ExpectPrepare(query).
+		ExpectExec().WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{int64(1)}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestStatementCache_Invalidate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	cache := NewStatementCache(8)
+	mock.ExpectPrepare("SELECT 1").WillBeClosed()
+	mock.ExpectPrepare("SELECT 2")
+
+	ctx := context.Background()
+	for _, key := range []statementKey{{db: db, table: "users"}, {db: db, table: "orders"}} {
+		entry, err := cache.acquire(ctx, key, func() string {
+			if key.table == "users" {
+				return "SELECT 1"
+			}
+			return "SELECT 2"
+		})
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		cache.release(entry)
+	}
+
+	cache.Invalidate("users")
+	if cache.Len() != 1 {
+		t.Fatalf("cache.Len() = %d, want 1", cache.Len())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
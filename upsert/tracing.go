@@ -0,0 +1,70 @@
+package upsert
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/cantart/upsert-benchmark/upsert"
+
+// naiveSpanRows is how many rows NaiveUpserter covers with one child span.
+const naiveSpanRows = 500
+
+// WithTracerProvider records a span for every Upsert call, with child spans for batches,
+// unique index DDL and groups of naive rows. Failed spans carry the error and, when the
+// driver reports one, its SQLSTATE. Tracing is off by default.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracer = provider.Tracer(tracerName)
+	}
+}
+
+// startSpan starts a child span of ctx's span, or a no-op span without a tracer.
+func (o options) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if o.tracer == nil {
+		return ctx, noop.Span{}
+	}
+	return o.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// startUpsertSpan starts the span covering one Upsert call of strategy.
+func (o options) startUpsertSpan(ctx context.Context, strategy, table string, columns []string, rows [][]any) (context.Context, trace.Span) {
+	// db.system.name uses the OpenTelemetry names, which differ from Dialect.Name for PostgreSQL.
+	system := "postgresql"
+	if o.dialect != nil && o.dialect.Name() != Postgres.Name() {
+		system = o.dialect.Name()
+	}
+	return o.startSpan(ctx, "upsert "+table,
+		attribute.String("db.system.name", system),
+		attribute.String("db.collection.name", table),
+		attribute.String("upsert.strategy", strategy),
+		attribute.Int("upsert.columns", len(columns)),
+		attribute.Int("upsert.rows", len(rows)),
+	)
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		var state interface{ SQLState() string }
+		if errors.As(err, &state) {
+			span.SetAttributes(attribute.String("db.response.status_code", state.SQLState()))
+		}
+	}
+	span.End()
+}
+
+// batchAttributes describes the rows a batch span covers.
+func batchAttributes(start, end int) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("upsert.batch.first_row", start),
+		attribute.Int("upsert.rows", end-start),
+	}
+}
@@ -0,0 +1,127 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracer() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
+
+func spanAttr(span tracetest.SpanStub, key string) attribute.Value {
+	for _, attr := range span.Attributes {
+		if string(attr.Key) == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing_BatchedHashIndexed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	provider, exporter := newTestTracer()
+	upserter := NewBatchedHashIndexedUpserter(db, WithTracerProvider(provider)).(*BatchedHashIndexedUpserter).WithBatchSize(1)
+
+	for _, id := range []int64{1, 2} {
+		mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users"`)).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id"}, [][]any{{int64(1)}, {int64(2)}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	byName := make(map[string][]tracetest.SpanStub)
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	if len(byName["upsert users"]) != 1 || len(byName["upsert.batch"]) != 2 || len(byName["upsert.ensure_index"]) != 2 {
+		t.Fatalf("spans = %v, want one call span, two batch spans and two index spans", spanNames(spans))
+	}
+
+	root := byName["upsert users"][0]
+	if got := spanAttr(root, "upsert.strategy").AsString(); got != "batched" {
+		t.Fatalf("upsert.strategy = %q, want batched", got)
+	}
+	if got := spanAttr(root, "upsert.rows").AsInt64(); got != 2 {
+		t.Fatalf("upsert.rows = %d, want 2", got)
+	}
+	if got := spanAttr(root, "db.system.name").AsString(); got != "postgresql" {
+		t.Fatalf("db.system.name = %q, want postgresql", got)
+	}
+	for _, batch := range byName["upsert.batch"] {
+		if batch.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Fatalf("batch span parent = %v, want the call span", batch.Parent.SpanID())
+		}
+	}
+	for _, index := range byName["upsert.ensure_index"] {
+		if index.Parent.SpanID() == root.SpanContext.SpanID() {
+			t.Fatal("index span should be a child of a batch span")
+		}
+	}
+}
+
+func TestTracing_RecordsSQLState(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	provider, exporter := newTestTracer()
+	upserter := NewNaiveUpserter(db, WithTracerProvider(provider))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT 1 FROM "users"`)).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users"`)).WillReturnError(&pq.Error{Code: "23502", Message: "null value"})
+	mock.ExpectRollback()
+
+	if err := upserter.Upsert(context.Background(), "users", []string{"id", "name"}, [][]any{{int64(1), nil}}, []string{"id"}); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %v, want a row group span and a call span", spanNames(spans))
+	}
+	for _, span := range spans {
+		if span.Status.Code != codes.Error {
+			t.Fatalf("span %s status = %v, want Error", span.Name, span.Status.Code)
+		}
+		if got := spanAttr(span, "db.response.status_code").AsString(); got != "23502" {
+			t.Fatalf("span %s db.response.status_code = %q, want 23502", span.Name, got)
+		}
+	}
+}
+
+func TestTracing_OffByDefault(t *testing.T) {
+	ctx, span := options{}.startSpan(context.Background(), "upsert")
+	if span.SpanContext().IsValid() || ctx != context.Background() {
+		t.Fatal("expected a no-op span without a tracer provider")
+	}
+}
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name
+	}
+	return names
+}
@@ -0,0 +1,238 @@
+package upsert
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Transform rewrites one value. It is applied to every value of its column, including NULLs.
+type Transform func(value any) (any, error)
+
+// RowView gives computed columns read access to a row by target column name.
+type RowView struct {
+	index  map[string]int
+	values []any
+}
+
+// Get returns the value of column, or nil if the row has no such column.
+func (r RowView) Get(column string) any {
+	if i, ok := r.index[column]; ok {
+		return r.values[i]
+	}
+	return nil
+}
+
+type addedColumn struct {
+	name    string
+	compute func(RowView) (any, error)
+}
+
+// TransformUpserter reshapes rows before passing them to the wrapped Upserter. In order it
+// drops ignored input columns, renames input columns to target columns, applies each
+// column's transforms, then appends constant and computed columns. The uniqueKeys given to
+// Upsert name target columns, and violations report target columns.
+type TransformUpserter struct {
+	upserter   Upserter
+	dropped    map[string]bool
+	renames    map[string]string
+	transforms map[string][]Transform
+	added      []addedColumn
+}
+
+func NewTransformUpserter(upserter Upserter) *TransformUpserter {
+	return &TransformUpserter{upserter: upserter}
+}
+
+// Rename returns a shallow copy that writes input column from to target column to.
+func (t *TransformUpserter) Rename(from, to string) *TransformUpserter {
+	clone := t.clone()
+	clone.renames[from] = to
+	return clone
+}
+
+// Drop returns a shallow copy that leaves the input columns out.
+func (t *TransformUpserter) Drop(columns ...string) *TransformUpserter {
+	clone := t.clone()
+	for _, col := range columns {
+		clone.dropped[col] = true
+	}
+	return clone
+}
+
+// Transform returns a shallow copy that applies fns, in order, to the target column. Calls
+// without the column, such as MapUpserter groups, are passed on without them.
+func (t *TransformUpserter) Transform(column string, fns ...Transform) *TransformUpserter {
+	clone := t.clone()
+	clone.transforms[column] = append(slices.Clip(clone.transforms[column]), fns...)
+	return clone
+}
+
+// Constant returns a shallow copy that adds column with value to every row.
+func (t *TransformUpserter) Constant(column string, value any) *TransformUpserter {
+	return t.Computed(column, func(RowView) (any, error) { return value, nil })
+}
+
+// Computed returns a shallow copy that adds column, computing its value from the
+// transformed row. Computed columns see the columns added before them.
+func (t *TransformUpserter) Computed(column string, compute func(RowView) (any, error)) *TransformUpserter {
+	clone := t.clone()
+	clone.added = append(slices.Clip(clone.added), addedColumn{name: column, compute: compute})
+	return clone
+}
+
+func (t *TransformUpserter) clone() *TransformUpserter {
+	clone := *t
+	clone.dropped = maps.Clone(t.dropped)
+	clone.renames = maps.Clone(t.renames)
+	clone.transforms = maps.Clone(t.transforms)
+	if clone.dropped == nil {
+		clone.dropped = make(map[string]bool)
+	}
+	if clone.renames == nil {
+		clone.renames = make(map[string]string)
+	}
+	if clone.transforms == nil {
+		clone.transforms = make(map[string][]Transform)
+	}
+	return &clone
+}
+
+func (t *TransformUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	targets, sources, err := t.targetColumns(columns)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[string]int, len(targets))
+	for i, col := range targets {
+		index[col] = i
+	}
+	transforms := make([][]Transform, len(sources))
+	for col, fns := range t.transforms {
+		i, ok := index[col]
+		switch {
+		case ok && i < len(sources):
+			transforms[i] = fns
+		case ok:
+			return fmt.Errorf("transform for %q, which is an added column", col)
+		case slices.Contains(columns, col):
+			return fmt.Errorf("transform for %q, which is dropped or renamed", col)
+		}
+	}
+
+	out := make([][]any, len(rows))
+	var violations []Violation
+	for r, row := range rows {
+		if len(row) != len(columns) {
+			return fmt.Errorf("row %d: expected %d values, got %d", r, len(columns), len(row))
+		}
+		values := make([]any, len(targets))
+		for i, src := range sources {
+			value := row[src]
+			for _, fn := range transforms[i] {
+				if value, err = fn(value); err != nil {
+					violations = append(violations, Violation{Row: r, Column: i, Name: targets[i], Value: row[src], Reason: err.Error()})
+					break
+				}
+			}
+			values[i] = value
+		}
+		view := RowView{index: index, values: values}
+		for i, add := range t.added {
+			pos := len(sources) + i
+			if values[pos], err = add.compute(view); err != nil {
+				violations = append(violations, Violation{Row: r, Column: pos, Name: add.name, Reason: err.Error()})
+			}
+		}
+		out[r] = values
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return t.upserter.Upsert(ctx, table, targets, out, uniqueKeys)
+}
+
+// targetColumns returns the output columns and, for each kept input column, its index in columns.
+func (t *TransformUpserter) targetColumns(columns []string) (targets []string, sources []int, err error) {
+	seen := make(map[string]bool, len(columns)+len(t.added))
+	claim := func(col string) error {
+		if seen[col] {
+			return fmt.Errorf("duplicate target column %q", col)
+		}
+		seen[col] = true
+		targets = append(targets, col)
+		return nil
+	}
+
+	for i, col := range columns {
+		if t.dropped[col] {
+			continue
+		}
+		if to, ok := t.renames[col]; ok {
+			col = to
+		}
+		if err := claim(col); err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, i)
+	}
+	for _, add := range t.added {
+		if err := claim(add.name); err != nil {
+			return nil, nil, err
+		}
+	}
+	return targets, sources, nil
+}
+
+// mapString applies fn to string and []byte values and passes other values through.
+func mapString(fn func(string) string) Transform {
+	return func(value any) (any, error) {
+		switch v := value.(type) {
+		case string:
+			return fn(v), nil
+		case []byte:
+			return fn(string(v)), nil
+		}
+		return value, nil
+	}
+}
+
+var (
+	// TrimSpace removes leading and trailing white space from text values.
+	TrimSpace = mapString(strings.TrimSpace)
+	// Lowercase maps text values to lower case, e.g. to normalize emails.
+	Lowercase = mapString(strings.ToLower)
+	// Uppercase maps text values to upper case.
+	Uppercase = mapString(strings.ToUpper)
+)
+
+// NullIfEmpty turns empty strings into NULL.
+func NullIfEmpty(value any) (any, error) {
+	if s, ok := value.(string); ok && s == "" {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// HashPII replaces non-NULL values with the hex HMAC-SHA256 of their text under key, so
+// equal inputs still match across loads without storing the originals. NULL stays NULL.
+func HashPII(key []byte) Transform {
+	return func(value any) (any, error) {
+		if value == nil {
+			return nil, nil
+		}
+		mac := hmac.New(sha256.New, key)
+		if raw, ok := value.([]byte); ok {
+			mac.Write(raw)
+		} else {
+			fmt.Fprint(mac, value)
+		}
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+}
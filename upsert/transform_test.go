@@ -0,0 +1,127 @@
+package upsert
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTransformUpserterUpsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter := NewTransformUpserter(NewHashIndexedUpserter(db)).
+		Drop("debug").
+		Rename("mail", "email").
+		Transform("email", TrimSpace, Lowercase).
+		Transform("phone", NullIfEmpty).
+		Constant("source", "crm").
+		Computed("domain", func(row RowView) (any, error) {
+			email, _ := row.Get("email").(string)
+			_, domain, _ := strings.Cut(email, "@")
+			return domain, nil
+		})
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("email", "phone", "source", "domain") VALUES ($1, $2, $3, $4), ($5, $6, $7, $8) ON CONFLICT ("email") DO UPDATE SET "phone" = EXCLUDED."phone", "source" = EXCLUDED."source", "domain" = EXCLUDED."domain"`)).
+		WithArgs("john@example.com", nil, "crm", "example.com", "jane@example.org", "555", "crm", "example.org").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	columns := []string{"mail", "debug", "phone"}
+	rows := [][]any{
+		{" John@Example.com ", "x", ""},
+		{"jane@example.org", "y", "555"},
+	}
+	if err := upserter.Upsert(context.Background(), "users", columns, rows, []string{"email"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if rows[0][0] != " John@Example.com " {
+		t.Fatalf("Upsert modified its input: %v", rows[0])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestTransformUpserterUpsert_Errors(t *testing.T) {
+	failing := func(value any) (any, error) {
+		if value == "bad" {
+			return nil, errors.New("rejected")
+		}
+		return value, nil
+	}
+	base := NewTransformUpserter(nil)
+
+	tests := []struct {
+		name     string
+		upserter *TransformUpserter
+		columns  []string
+		rows     [][]any
+	}{
+		{name: "duplicateTarget", upserter: base.Rename("a", "b"), columns: []string{"a", "b"}, rows: [][]any{{1, 2}}},
+		{name: "addedCollides", upserter: base.Constant("a", 1), columns: []string{"a"}, rows: [][]any{{1}}},
+		{name: "droppedTransform", upserter: base.Drop("b").Transform("b", TrimSpace), columns: []string{"a", "b"}, rows: [][]any{{1, 2}}},
+		{name: "renamedTransform", upserter: base.Rename("b", "c").Transform("b", TrimSpace), columns: []string{"a", "b"}, rows: [][]any{{1, 2}}},
+		{name: "addedTransform", upserter: base.Constant("c", 1).Transform("c", TrimSpace), columns: []string{"a"}, rows: [][]any{{1}}},
+		{name: "transformFails", upserter: base.Transform("a", failing), columns: []string{"a"}, rows: [][]any{{"ok"}, {"bad"}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.upserter.Upsert(context.Background(), "users", tc.columns, tc.rows, []string{"a"}); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestTransformUpserterUpsert_AbsentColumn(t *testing.T) {
+	var got [][]any
+	capture := UpserterFunc(func(_ context.Context, _ string, columns []string, rows [][]any, _ []string) error {
+		got = append(got, append([]any{columns}, rows[0]...))
+		return nil
+	})
+	// MapUpserter groups send only the columns each row has.
+	upserter := NewMapUpserter(NewTransformUpserter(capture).Transform("email", Lowercase)).WithMissingUnchanged()
+	rows := []map[string]any{{"id": 1, "email": "JOHN@EXAMPLE.COM"}, {"id": 2, "name": "Jane"}}
+	if err := upserter.Upsert(context.Background(), "users", rows, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	want := [][]any{
+		{[]string{"email", "id"}, "john@example.com", 1},
+		{[]string{"id", "name"}, 2, "Jane"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("calls = %v, want %v", got, want)
+	}
+}
+
+func TestTransformUpserter_CopiesOnWrite(t *testing.T) {
+	base := NewTransformUpserter(nil).Rename("a", "b")
+	_ = base.Rename("a", "c").Drop("x")
+	if base.renames["a"] != "b" || base.dropped["x"] {
+		t.Fatalf("derived upserter changed its base: renames %v, dropped %v", base.renames, base.dropped)
+	}
+}
+
+func TestHashPII(t *testing.T) {
+	hash := HashPII([]byte("secret"))
+	a, _ := hash("john@example.com")
+	b, _ := hash([]byte("john@example.com"))
+	c, _ := HashPII([]byte("other"))("john@example.com")
+	if a != b || a == c || len(a.(string)) != 64 {
+		t.Fatalf("HashPII = %v, %v, %v; want equal hex digests per key", a, b, c)
+	}
+	if null, _ := hash(nil); null != nil {
+		t.Fatalf("HashPII(nil) = %v, want nil", null)
+	}
+}
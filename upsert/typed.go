@@ -0,0 +1,164 @@
+package upsert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// TypedUpserter upserts slices of structs, deriving columns from `db:"name"` tags
+// and unique keys from fields tagged `upsert:"key"`.
+type TypedUpserter[T any] struct {
+	upserter Upserter
+	meta     *structMeta
+}
+
+// structMeta is the cached column layout of a struct type.
+type structMeta struct {
+	columns    []string
+	uniqueKeys []string
+	fields     [][]int
+}
+
+var structMetaCache sync.Map // map[reflect.Type]*structMeta
+
+// NewTypedUpserter builds a TypedUpserter for T, which must be a struct or a pointer to a struct.
+func NewTypedUpserter[T any](upserter Upserter) (*TypedUpserter[T], error) {
+	if upserter == nil {
+		return nil, errors.New("upserter is required")
+	}
+	meta, err := loadStructMeta(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, err
+	}
+	return &TypedUpserter[T]{upserter: upserter, meta: meta}, nil
+}
+
+// Columns returns the column names derived from T in field order.
+func (t *TypedUpserter[T]) Columns() []string {
+	return append([]string(nil), t.meta.columns...)
+}
+
+// UniqueKeys returns the columns tagged as unique keys in field order.
+func (t *TypedUpserter[T]) UniqueKeys() []string {
+	return append([]string(nil), t.meta.uniqueKeys...)
+}
+
+func (t *TypedUpserter[T]) Upsert(ctx context.Context, table string, items []T) error {
+	if len(items) == 0 {
+		return nil
+	}
+	rows, err := t.Rows(items)
+	if err != nil {
+		return err
+	}
+	return t.upserter.Upsert(ctx, table, t.meta.columns, rows, t.meta.uniqueKeys)
+}
+
+// Rows converts items into the row layout expected by Upserter implementations.
+func (t *TypedUpserter[T]) Rows(items []T) ([][]any, error) {
+	rows := make([][]any, len(items))
+	for i := range items {
+		v := reflect.ValueOf(&items[i]).Elem()
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil, fmt.Errorf("item %d: nil pointer", i)
+			}
+			v = v.Elem()
+		}
+		row := make([]any, len(t.meta.fields))
+		for j, path := range t.meta.fields {
+			field, err := v.FieldByIndexErr(path)
+			if err != nil {
+				// A nil embedded pointer leaves its promoted columns NULL.
+				row[j] = nil
+				continue
+			}
+			row[j] = field.Interface()
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+func loadStructMeta(typ reflect.Type) (*structMeta, error) {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type %s is not a struct", typ)
+	}
+	if cached, ok := structMetaCache.Load(typ); ok {
+		return cached.(*structMeta), nil
+	}
+
+	meta := &structMeta{}
+	if err := collectFields(typ, nil, meta); err != nil {
+		return nil, err
+	}
+	if len(meta.columns) == 0 {
+		return nil, fmt.Errorf("type %s has no fields tagged with db", typ)
+	}
+	if len(meta.uniqueKeys) == 0 {
+		return nil, fmt.Errorf("type %s has no fields tagged with upsert:\"key\"", typ)
+	}
+
+	seen := make(map[string]struct{}, len(meta.columns))
+	for _, col := range meta.columns {
+		if _, dup := seen[col]; dup {
+			return nil, fmt.Errorf("type %s maps column %q more than once", typ, col)
+		}
+		seen[col] = struct{}{}
+	}
+
+	actual, _ := structMetaCache.LoadOrStore(typ, meta)
+	return actual.(*structMeta), nil
+}
+
+// collectFields walks typ depth-first, flattening untagged embedded structs.
+func collectFields(typ reflect.Type, prefix []int, meta *structMeta) error {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		path := append(append([]int(nil), prefix...), i)
+
+		tag, tagged := field.Tag.Lookup("db")
+		if tag == "-" {
+			continue
+		}
+		if !tagged {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if field.Anonymous && embedded.Kind() == reflect.Struct {
+				if err := collectFields(embedded, path, meta); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			return fmt.Errorf("field %s: db tag on unexported field", field.Name)
+		}
+		if tag == "" {
+			return fmt.Errorf("field %s: empty db tag", field.Name)
+		}
+
+		meta.columns = append(meta.columns, tag)
+		meta.fields = append(meta.fields, path)
+
+		for _, opt := range strings.Split(field.Tag.Get("upsert"), ",") {
+			switch strings.TrimSpace(opt) {
+			case "":
+			case "key":
+				meta.uniqueKeys = append(meta.uniqueKeys, tag)
+			default:
+				return fmt.Errorf("field %s: unknown upsert tag option %q", field.Name, opt)
+			}
+		}
+	}
+	return nil
+}
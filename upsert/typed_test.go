@@ -0,0 +1,107 @@
+package upsert
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+type typedAudit struct {
+	UpdatedBy string `db:"updated_by"`
+}
+
+type typedUser struct {
+	ID    int64  `db:"id" upsert:"key"`
+	Name  string `db:"name"`
+	Email string `db:"email"`
+	Notes string `db:"-"`
+	typedAudit
+	internal int
+}
+
+func TestTypedUpserterUpsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	upserter, err := NewTypedUpserter[typedUser](NewHashIndexedUpserter(db))
+	if err != nil {
+		t.Fatalf("NewTypedUpserter: %v", err)
+	}
+
+	if got, want := upserter.Columns(), []string{"id", "name", "email", "updated_by"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Columns() = %v, want %v", got, want)
+	}
+	if got, want := upserter.UniqueKeys(), []string{"id"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("UniqueKeys() = %v, want %v", got, want)
+	}
+
+	users := []typedUser{
+		{ID: 1, Name: "John", Email: "john@example.com", Notes: "ignored", typedAudit: typedAudit{UpdatedBy: "sync"}},
+		{ID: 2, Name: "Jane", Email: "jane@example.com"},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id", "name", "email", "updated_by") VALUES ($1, $2, $3, $4), ($5, $6, $7, $8) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "email" = EXCLUDED."email", "updated_by" = EXCLUDED."updated_by"`)).
+		WithArgs(int64(1), "John", "john@example.com", "sync", int64(2), "Jane", "jane@example.com", "").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	if err := upserter.Upsert(context.Background(), "users", users); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestTypedUpserterRows_Pointers(t *testing.T) {
+	upserter, err := NewTypedUpserter[*typedUser](NewNaiveUpserter(nil))
+	if err != nil {
+		t.Fatalf("NewTypedUpserter: %v", err)
+	}
+
+	rows, err := upserter.Rows([]*typedUser{{ID: 7, Name: "Ann", Email: "ann@example.com"}})
+	if err != nil {
+		t.Fatalf("Rows: %v", err)
+	}
+	want := [][]any{{int64(7), "Ann", "ann@example.com", ""}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("Rows() = %v, want %v", rows, want)
+	}
+
+	if _, err := upserter.Rows([]*typedUser{nil}); err == nil {
+		t.Fatal("expected error for nil item, got nil")
+	}
+}
+
+func TestNewTypedUpserter_InvalidTypes(t *testing.T) {
+	type noKey struct {
+		ID int64 `db:"id"`
+	}
+	type badOption struct {
+		ID int64 `db:"id" upsert:"primary"`
+	}
+	type duplicate struct {
+		ID    int64 `db:"id" upsert:"key"`
+		Other int64 `db:"id"`
+	}
+
+	if _, err := NewTypedUpserter[noKey](NewNaiveUpserter(nil)); err == nil {
+		t.Fatal("expected error for struct without unique key, got nil")
+	}
+	if _, err := NewTypedUpserter[badOption](NewNaiveUpserter(nil)); err == nil {
+		t.Fatal("expected error for unknown tag option, got nil")
+	}
+	if _, err := NewTypedUpserter[duplicate](NewNaiveUpserter(nil)); err == nil {
+		t.Fatal("expected error for duplicate column, got nil")
+	}
+	if _, err := NewTypedUpserter[int](NewNaiveUpserter(nil)); err == nil {
+		t.Fatal("expected error for non-struct type, got nil")
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"sync"
 	"testing"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
 )
 
@@ -31,6 +33,12 @@ func BenchmarkRealUpserters(b *testing.B) {
 		b.Skipf("skipping integration benchmarks: %v", err)
 	}
 
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		b.Fatalf("pgxpool.New: %v", err)
+	}
+	defer pool.Close()
+
 	const tableName = "bench_real_users"
 	tableIdent, err := quoteIdentifier(tableName)
 	if err != nil {
@@ -50,19 +58,15 @@ func BenchmarkRealUpserters(b *testing.B) {
 		rows := generateIntegrationRows(count)
 		half := len(rows) / 2
 
-		b.Run(fmt.Sprintf("rows=%d/Naive", count), func(b *testing.B) {
-			runIntegrationBenchmark(b, db, tableName, tableIdent, columns, uniqueKeys, rows, half, NewNaiveUpserter(db))
-		})
-
-		b.Run(fmt.Sprintf("rows=%d/HashIndexed", count), func(b *testing.B) {
-			runIntegrationBenchmark(b, db, tableName, tableIdent, columns, uniqueKeys, rows, half, NewHashIndexedUpserter(db))
-		})
-
-		b.Run(fmt.Sprintf("rows=%d/BatchedHashIndexed", count), func(b *testing.B) {
-			base := NewBatchedHashIndexedUpserter(db).(*BatchedHashIndexedUpserter)
-			upserter := base.WithBatchSize(512)
-			runIntegrationBenchmark(b, db, tableName, tableIdent, columns, uniqueKeys, rows, half, upserter)
-		})
+		for _, strategy := range Strategies() {
+			upserter, err := New(strategy, StrategyConfig{DB: db, Pgx: pool, BatchSize: 512})
+			if err != nil {
+				b.Fatalf("New(%q): %v", strategy, err)
+			}
+			b.Run(fmt.Sprintf("rows=%d/%s", count, strategy), func(b *testing.B) {
+				runIntegrationBenchmark(b, db, tableName, tableIdent, columns, uniqueKeys, rows, half, upserter)
+			})
+		}
 	}
 }
 
@@ -104,3 +108,81 @@ func generateIntegrationRows(count int) [][]any {
 	}
 	return rows
 }
+
+// TestAdvisoryLocks_Concurrent races several NaiveUpserters over the same keys on a table
+// without a unique index. Without locks they insert duplicates; with LockKeys or
+// LockTable they must not.
+func TestAdvisoryLocks_Concurrent(t *testing.T) {
+	dsn := os.Getenv("UPSERT_BENCHMARK_DSN")
+	if dsn == "" {
+		dsn = defaultIntegrationDSN
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := db.PingContext(ctx); err != nil {
+		t.Skipf("skipping integration test: %v", err)
+	}
+
+	const tableName = "advisory_lock_users"
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS advisory_lock_users (id BIGINT NOT NULL, name TEXT NOT NULL)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	defer db.ExecContext(ctx, "DROP TABLE advisory_lock_users")
+
+	// At most maxKeyLocks rows, so LockKeys takes key locks rather than the table lock.
+	rows := generateIntegrationRows(maxKeyLocks)
+	race := func(t *testing.T, opts ...Option) int {
+		t.Helper()
+		if _, err := db.ExecContext(ctx, "TRUNCATE advisory_lock_users"); err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- NewNaiveUpserter(db, opts...).Upsert(ctx, tableName, []string{"id", "name"}, rows, []string{"id"})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("Upsert: %v", err)
+			}
+		}
+
+		var duplicates int
+		if err := db.QueryRowContext(ctx, "SELECT count(*) - count(DISTINCT id) FROM advisory_lock_users").Scan(&duplicates); err != nil {
+			t.Fatalf("count duplicates: %v", err)
+		}
+		return duplicates
+	}
+
+	t.Run("without locks", func(t *testing.T) {
+		// The race is timing dependent, so give it a few tries to show the duplicates the
+		// locks below prevent.
+		for range 5 {
+			if duplicates := race(t); duplicates > 0 {
+				return
+			}
+		}
+		t.Fatal("no duplicate rows without locks in 5 runs; the test cannot show what the locks prevent")
+	})
+	t.Run("with key locks", func(t *testing.T) {
+		if duplicates := race(t, WithAdvisoryLocks(LockKeys)); duplicates != 0 {
+			t.Fatalf("%d duplicate rows with advisory locks", duplicates)
+		}
+	})
+	t.Run("with table lock", func(t *testing.T) {
+		if duplicates := race(t, WithAdvisoryLocks(LockTable)); duplicates != 0 {
+			t.Fatalf("%d duplicate rows with advisory locks", duplicates)
+		}
+	})
+}
@@ -11,41 +11,14 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 )
 
-func BenchmarkUpserters(b *testing.B) {
-	rowCounts := []int{1, 32, 128}
-	for _, count := range rowCounts {
-		rows := generateBenchmarkRows(count)
-		name := fmt.Sprintf("rows=%d", count)
-		b.Run(name, func(b *testing.B) {
-			b.Run("Naive", func(b *testing.B) {
-				benchmarkNaiveUpserter(b, rows)
-			})
-			b.Run("HashIndexed", func(b *testing.B) {
-				benchmarkHashIndexedUpserter(b, rows)
-			})
-			b.Run("BatchedHashIndexed", func(b *testing.B) {
-				benchmarkBatchedHashIndexedUpserter(b, rows, 128)
-			})
-		})
-	}
-}
-
-func benchmarkNaiveUpserter(b *testing.B, rows [][]any) {
-	b.Helper()
-	b.ReportAllocs()
-
-	columns := []string{"id", "name"}
-	uniqueKeys := []string{"id"}
-	ctx := context.Background()
-
-	for b.Loop() {
-		b.StopTimer()
-		db, mock, err := sqlmock.New()
-		if err != nil {
-			b.Fatalf("sqlmock.New: %v", err)
-		}
-		upserter := NewNaiveUpserter(db)
-
+// benchmarkBatchSize is the batch size of the batched strategies in BenchmarkUpserters.
+const benchmarkBatchSize = 128
+
+// benchmarkExpectations sets up the sqlmock expectations of one Upsert of rows into
+// users(id, name) for each registered strategy. Strategies without an entry, such as the
+// pgx ones, are left to BenchmarkRealUpserters.
+var benchmarkExpectations = map[string]func(mock sqlmock.Sqlmock, rows [][]any){
+	"naive": func(mock sqlmock.Sqlmock, rows [][]any) {
 		mock.ExpectBegin()
 		for _, row := range rows {
 			mock.ExpectQuery("SELECT 1 FROM .*").
@@ -56,66 +29,58 @@ func benchmarkNaiveUpserter(b *testing.B, rows [][]any) {
 				WillReturnResult(sqlmock.NewResult(0, 1))
 		}
 		mock.ExpectCommit()
-		mock.ExpectClose()
-
-		b.StartTimer()
-		if err := upserter.Upsert(ctx, "users", columns, rows, uniqueKeys); err != nil {
-			b.Fatalf("Upsert: %v", err)
-		}
-		b.StopTimer()
-
-		if err := db.Close(); err != nil {
-			b.Fatalf("db.Close: %v", err)
-		}
-		if err := mock.ExpectationsWereMet(); err != nil {
-			b.Fatalf("unmet expectations: %v", err)
-		}
-		b.StartTimer()
-	}
-}
-
-func benchmarkHashIndexedUpserter(b *testing.B, rows [][]any) {
-	b.Helper()
-	b.ReportAllocs()
-
-	columns := []string{"id", "name"}
-	uniqueKeys := []string{"id"}
-	ctx := context.Background()
-
-	args := flattenDriverValues(rows)
-
-	for b.Loop() {
-		b.StopTimer()
-		db, mock, err := sqlmock.New()
-		if err != nil {
-			b.Fatalf("sqlmock.New: %v", err)
-		}
-		upserter := NewHashIndexedUpserter(db)
-
+	},
+	"hash": func(mock sqlmock.Sqlmock, rows [][]any) {
 		mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`)).
 			WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("INSERT INTO .*").
-			WithArgs(args...).
+			WithArgs(flattenDriverValues(rows)...).
 			WillReturnResult(sqlmock.NewResult(0, int64(len(rows))))
-		mock.ExpectClose()
-
-		b.StartTimer()
-		if err := upserter.Upsert(ctx, "users", columns, rows, uniqueKeys); err != nil {
-			b.Fatalf("Upsert: %v", err)
-		}
-		b.StopTimer()
-
-		if err := db.Close(); err != nil {
-			b.Fatalf("db.Close: %v", err)
+	},
+	"batched": func(mock sqlmock.Sqlmock, rows [][]any) {
+		for start := 0; start < len(rows); start += benchmarkBatchSize {
+			chunk := rows[start:min(start+benchmarkBatchSize, len(rows))]
+			mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`)).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("INSERT INTO .*").
+				WithArgs(flattenDriverValues(chunk)...).
+				WillReturnResult(sqlmock.NewResult(0, int64(len(chunk))))
 		}
-		if err := mock.ExpectationsWereMet(); err != nil {
-			b.Fatalf("unmet expectations: %v", err)
+	},
+	"batched-naive": func(mock sqlmock.Sqlmock, rows [][]any) {
+		for start := 0; start < len(rows); start += benchmarkBatchSize {
+			chunk := rows[start:min(start+benchmarkBatchSize, len(rows))]
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT v.ord FROM .*").
+				WillReturnRows(sqlmock.NewRows([]string{"ord"}))
+			mock.ExpectExec("INSERT INTO .*").
+				WithArgs(flattenDriverValues(chunk)...).
+				WillReturnResult(sqlmock.NewResult(0, int64(len(chunk))))
+			mock.ExpectCommit()
 		}
-		b.StartTimer()
+	},
+}
+
+func BenchmarkUpserters(b *testing.B) {
+	rowCounts := []int{1, 32, 128}
+	for _, count := range rowCounts {
+		rows := generateBenchmarkRows(count)
+		name := fmt.Sprintf("rows=%d", count)
+		b.Run(name, func(b *testing.B) {
+			for _, strategy := range Strategies() {
+				b.Run(strategy, func(b *testing.B) {
+					expect, ok := benchmarkExpectations[strategy]
+					if !ok {
+						b.Skipf("no sqlmock expectations for %s", strategy)
+					}
+					benchmarkUpserter(b, strategy, rows, expect)
+				})
+			}
+		})
 	}
 }
 
-func benchmarkBatchedHashIndexedUpserter(b *testing.B, rows [][]any, batchSize int) {
+func benchmarkUpserter(b *testing.B, strategy string, rows [][]any, expect func(sqlmock.Sqlmock, [][]any)) {
 	b.Helper()
 	b.ReportAllocs()
 
@@ -129,18 +94,11 @@ func benchmarkBatchedHashIndexedUpserter(b *testing.B, rows [][]any, batchSize i
 		if err != nil {
 			b.Fatalf("sqlmock.New: %v", err)
 		}
-		base := NewBatchedHashIndexedUpserter(db).(*BatchedHashIndexedUpserter)
-		upserter := base.WithBatchSize(batchSize)
-
-		for start := 0; start < len(rows); start += batchSize {
-			end := min(start+batchSize, len(rows))
-			chunk := rows[start:end]
-			mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`)).
-				WillReturnResult(sqlmock.NewResult(0, 0))
-			mock.ExpectExec("INSERT INTO .*").
-				WithArgs(flattenDriverValues(chunk)...).
-				WillReturnResult(sqlmock.NewResult(0, int64(len(chunk))))
+		upserter, err := New(strategy, StrategyConfig{DB: db, BatchSize: benchmarkBatchSize})
+		if err != nil {
+			b.Fatalf("New(%q): %v", strategy, err)
 		}
+		expect(mock, rows)
 		mock.ExpectClose()
 
 		b.StartTimer()
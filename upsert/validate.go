@@ -0,0 +1,350 @@
+package upsert
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxReportedViolations caps how many violations ValidationError.Error lists.
+const maxReportedViolations = 10
+
+// Violation is one value that does not fit its column.
+type Violation struct {
+	Row    int
+	Column int
+	Name   string
+	Value  any
+	Reason string
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("row %d, column %d (%s): %s", v.Row, v.Column, v.Name, v.Reason)
+}
+
+// ValidationError lists every violation found in a call, in row then column order.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d invalid values", len(e.Violations))
+	for i, v := range e.Violations {
+		if i == maxReportedViolations {
+			fmt.Fprintf(&b, "; and %d more", len(e.Violations)-i)
+			break
+		}
+		b.WriteString("; ")
+		b.WriteString(v.Error())
+	}
+	return b.String()
+}
+
+// ValidateRows checks rows against the introspected columns of their table without
+// touching the database. It checks nullability, varchar(n) and char(n) lengths, integer
+// ranges, numeric(p, s) integer digits, booleans, date and time strings and UUIDs; values
+// of other types, such as json or arrays, are left to the database. It returns a
+// *ValidationError listing every violation, or nil.
+func ValidateRows(info []ColumnInfo, columns []string, rows [][]any) error {
+	byName := make(map[string]ColumnInfo, len(info))
+	for _, col := range info {
+		byName[col.Name] = col
+	}
+	targets := make([]*ColumnInfo, len(columns))
+	for i, name := range columns {
+		if col, ok := byName[name]; ok {
+			targets[i] = &col
+		}
+	}
+
+	var violations []Violation
+	for r, row := range rows {
+		for c, value := range row {
+			if c >= len(columns) {
+				break
+			}
+			var reason string
+			if targets[c] == nil {
+				reason = "column does not exist"
+			} else {
+				reason = checkValue(*targets[c], value)
+			}
+			if reason != "" {
+				violations = append(violations, Violation{Row: r, Column: c, Name: columns[c], Value: value, Reason: reason})
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// checkValue returns why value cannot be stored in col, or "".
+func checkValue(col ColumnInfo, value any) string {
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return err.Error()
+		}
+		value = v
+	}
+	if value == nil {
+		if !col.Nullable {
+			return "NULL in NOT NULL column"
+		}
+		return ""
+	}
+	if raw, ok := value.([]byte); ok && col.UDTName != "bytea" {
+		value = string(raw)
+	}
+
+	switch col.DataType {
+	case "character varying", "character":
+		if s, ok := value.(string); ok && col.MaxLength > 0 && utf8.RuneCountInString(s) > col.MaxLength {
+			return fmt.Sprintf("%d characters exceed %s(%d)", utf8.RuneCountInString(s), col.UDTName, col.MaxLength)
+		}
+	case "smallint":
+		return checkInteger(value, math.MinInt16, math.MaxInt16)
+	case "integer":
+		return checkInteger(value, math.MinInt32, math.MaxInt32)
+	case "bigint":
+		return checkInteger(value, math.MinInt64, math.MaxInt64)
+	case "numeric":
+		return checkNumeric(value, col.NumericPrecision, col.NumericScale)
+	case "real", "double precision":
+		if s, ok := value.(string); ok {
+			if _, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err != nil && !isSpecialFloat(s) {
+				return fmt.Sprintf("%q is not a number", s)
+			}
+		}
+	case "boolean":
+		if s, ok := value.(string); ok && !isBoolText(s) {
+			return fmt.Sprintf("%q is not a boolean", s)
+		}
+	case "date", "timestamp without time zone", "timestamp with time zone":
+		if s, ok := value.(string); ok && !isTimestampText(s) {
+			return fmt.Sprintf("%q is not a %s", s, col.DataType)
+		}
+	case "time without time zone", "time with time zone":
+		if s, ok := value.(string); ok && !isTimeOfDayText(s) {
+			return fmt.Sprintf("%q is not a time", s)
+		}
+	case "uuid":
+		if s, ok := value.(string); ok && !isUUIDText(s) {
+			return fmt.Sprintf("%q is not a UUID", s)
+		}
+	}
+	return ""
+}
+
+// checkInteger reports values outside [lo, hi] and strings or floats that are not whole numbers.
+func checkInteger(value any, lo, hi int64) string {
+	outOfRange := func(v any) string { return fmt.Sprintf("%v is out of range [%d, %d]", v, lo, hi) }
+	switch v := value.(type) {
+	case int:
+		return checkInteger(int64(v), lo, hi)
+	case int8:
+		return checkInteger(int64(v), lo, hi)
+	case int16:
+		return checkInteger(int64(v), lo, hi)
+	case int32:
+		return checkInteger(int64(v), lo, hi)
+	case int64:
+		if v < lo || v > hi {
+			return outOfRange(v)
+		}
+	case uint:
+		return checkInteger(uint64(v), lo, hi)
+	case uint8:
+		return checkInteger(uint64(v), lo, hi)
+	case uint16:
+		return checkInteger(uint64(v), lo, hi)
+	case uint32:
+		return checkInteger(uint64(v), lo, hi)
+	case uint64:
+		if v > uint64(hi) {
+			return outOfRange(v)
+		}
+	case float32:
+		return checkInteger(float64(v), lo, hi)
+	case json.Number:
+		// Drivers send it as text, which PostgreSQL reads like a string.
+		return checkInteger(string(v), lo, hi)
+	case float64:
+		// PostgreSQL rounds floats to the nearest integer; hi converts up to 2^63 for bigint.
+		if math.IsNaN(v) || math.Round(v) < float64(lo) || math.Round(v) >= float64(hi)+1 {
+			return outOfRange(v)
+		}
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return outOfRange(v)
+			}
+			return fmt.Sprintf("%q is not an integer", v)
+		}
+		if n < lo || n > hi {
+			return outOfRange(v)
+		}
+	case bool:
+		return "boolean in integer column"
+	}
+	return ""
+}
+
+// checkNumeric reports numbers with more integer digits than numeric(precision, scale)
+// allows. Extra fractional digits are rounded by the server and are not an error.
+func checkNumeric(value any, precision, scale int) string {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = strings.TrimSpace(v)
+	case json.Number:
+		text = string(v)
+	case float32, float64:
+		text = fmt.Sprintf("%f", v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		text = fmt.Sprintf("%d", v)
+	default:
+		return ""
+	}
+	if isSpecialFloat(text) {
+		return ""
+	}
+
+	digits := strings.TrimLeft(text, "+-")
+	if strings.ContainsAny(digits, "eE") {
+		// Exponent notation is rare enough to only check that it parses.
+		if _, err := strconv.ParseFloat(digits, 64); err != nil {
+			return fmt.Sprintf("%q is not a number", text)
+		}
+		return ""
+	}
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole+frac == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return fmt.Sprintf("%q is not a number", text)
+	}
+	if precision == 0 {
+		return ""
+	}
+	whole = strings.TrimLeft(whole, "0")
+	if len(whole) > precision-scale {
+		return fmt.Sprintf("%s exceeds numeric(%d, %d)", text, precision, scale)
+	}
+	return ""
+}
+
+func isSpecialFloat(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "nan", "infinity", "+infinity", "-infinity", "inf", "+inf", "-inf":
+		return true
+	}
+	return false
+}
+
+// isBoolText accepts the spellings PostgreSQL's boolin accepts.
+func isBoolText(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "t", "true", "y", "yes", "on", "1", "f", "false", "n", "no", "off", "0":
+		return true
+	}
+	return false
+}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04Z07:00",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func isTimestampText(s string) bool {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "infinity", "-infinity", "now", "today", "tomorrow", "yesterday", "epoch":
+		return true
+	}
+	for _, layout := range timestampLayouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+var timeOfDayLayouts = []string{
+	"15:04:05.999999999Z07:00",
+	"15:04:05.999999999Z07",
+	"15:04:05.999999999",
+	"15:04Z07:00",
+	"15:04",
+}
+
+func isTimeOfDayText(s string) bool {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeOfDayLayouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return s == "24:00" || s == "24:00:00"
+}
+
+// isUUIDText accepts 32 hex digits, optionally in braces and with hyphens between groups
+// of four, like PostgreSQL's uuid_in.
+func isUUIDText(s string) bool {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+	hex := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+			hex++
+		case c == '-' && hex%4 == 0 && hex > 0 && i+1 < len(s) && s[i+1] != '-':
+		default:
+			return false
+		}
+	}
+	return hex == 32
+}
+
+// ValidatingUpserter checks every call's rows with ValidateRows before passing them on,
+// so a bad value is reported with its row and column instead of failing a whole
+// multi-row statement. Rows are passed on unchanged; nothing is written if any is invalid.
+type ValidatingUpserter struct {
+	upserter Upserter
+	columns  *columnCache
+}
+
+func NewValidatingUpserter(upserter Upserter, db *sql.DB) *ValidatingUpserter {
+	return &ValidatingUpserter{upserter: upserter, columns: newColumnCache(db)}
+}
+
+func (v *ValidatingUpserter) Upsert(ctx context.Context, table string, columns []string, rows [][]any, uniqueKeys []string) error {
+	if len(rows) > 0 {
+		info, err := v.columns.get(ctx, table)
+		if err != nil {
+			return err
+		}
+		if err := ValidateRows(info, columns, rows); err != nil {
+			return err
+		}
+	}
+	return v.upserter.Upsert(ctx, table, columns, rows, uniqueKeys)
+}
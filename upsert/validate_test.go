@@ -0,0 +1,121 @@
+package upsert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var validateColumns = []ColumnInfo{
+	{Name: "id", DataType: "integer", UDTName: "int4"},
+	{Name: "name", DataType: "character varying", UDTName: "varchar", MaxLength: 5},
+	{Name: "price", DataType: "numeric", UDTName: "numeric", Nullable: true, NumericPrecision: 5, NumericScale: 2},
+	{Name: "seen_at", DataType: "timestamp with time zone", UDTName: "timestamptz", Nullable: true},
+	{Name: "ref", DataType: "uuid", UDTName: "uuid", Nullable: true},
+	{Name: "active", DataType: "boolean", UDTName: "bool", Nullable: true},
+}
+
+func TestValidateRows(t *testing.T) {
+	columns := []string{"id", "name", "price", "seen_at", "ref", "active"}
+	tests := []struct {
+		name   string
+		row    []any
+		column int
+	}{
+		{name: "valid", row: []any{int64(1), "Jane", "999.99", time.Now(), "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", "yes"}, column: -1},
+		{name: "validText", row: []any{"42", []byte("Zoë"), 12.5, "2024-01-02 03:04:05+00", "{A0EEBC999C0B4EF8BB6D6BB9BD380A11}", true}, column: -1},
+		{name: "nullInNotNull", row: []any{nil, "Jane", nil, nil, nil, nil}, column: 0},
+		{name: "integerOverflow", row: []any{int64(1) << 31, "Jane", nil, nil, nil, nil}, column: 0},
+		{name: "integerText", row: []any{"1.5", "Jane", nil, nil, nil, nil}, column: 0},
+		{name: "validJSONNumbers", row: []any{json.Number("42"), "Jane", json.Number("999.99"), nil, nil, nil}, column: -1},
+		{name: "integerJSONNumberOverflow", row: []any{json.Number("2147483648"), "Jane", nil, nil, nil, nil}, column: 0},
+		{name: "integerJSONNumberFraction", row: []any{json.Number("1.5"), "Jane", nil, nil, nil, nil}, column: 0},
+		{name: "numericJSONNumberOverflow", row: []any{1, "Jane", json.Number("1000"), nil, nil, nil}, column: 2},
+		{name: "tooLong", row: []any{1, "Janet!", nil, nil, nil, nil}, column: 1},
+		{name: "numericOverflow", row: []any{1, "Jane", "1000", nil, nil, nil}, column: 2},
+		{name: "numericText", row: []any{1, "Jane", "12,5", nil, nil, nil}, column: 2},
+		{name: "badTimestamp", row: []any{1, "Jane", nil, "yesterday-ish", nil, nil}, column: 3},
+		{name: "badUUID", row: []any{1, "Jane", nil, nil, "a0eebc99-9c0b", nil}, column: 4},
+		{name: "badBool", row: []any{1, "Jane", nil, nil, nil, "maybe"}, column: 5},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRows(validateColumns, columns, [][]any{tc.row})
+			if tc.column < 0 {
+				if err != nil {
+					t.Fatalf("ValidateRows: %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("ValidateRows() = %v, want *ValidationError", err)
+			}
+			if len(verr.Violations) != 1 || verr.Violations[0].Column != tc.column {
+				t.Fatalf("violations = %+v, want one in column %d", verr.Violations, tc.column)
+			}
+		})
+	}
+}
+
+func TestValidateRows_ReportsAllViolations(t *testing.T) {
+	rows := [][]any{{1, "ok"}, {nil, "too long"}, {"x", "ok"}}
+	err := ValidateRows(validateColumns, []string{"id", "name", "missing"}, rows)
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("ValidateRows() = %v, want *ValidationError", err)
+	}
+	got := make([]string, len(verr.Violations))
+	for i, v := range verr.Violations {
+		got[i] = v.Name
+	}
+	if want := "id name id"; strings.Join(got, " ") != want {
+		t.Fatalf("violating columns = %v, want %s", got, want)
+	}
+	if verr.Violations[2].Row != 2 {
+		t.Fatalf("third violation row = %d, want 2", verr.Violations[2].Row)
+	}
+	if !strings.Contains(err.Error(), "row 1, column 1 (name)") {
+		t.Fatalf("error %q does not name row 1, column 1", err)
+	}
+}
+
+func TestValidatingUpserterUpsert_StopsBeforeSQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(introspectColumnsQuery)).
+		WithArgs("users", "").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "udt_name", "nullable", "max_length", "precision", "scale"}).
+			AddRow("id", "bigint", "int8", false, 0, 64, 0).
+			AddRow("name", "character varying", "varchar", true, 4, 0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS "idx_de7ebd7b26552dfc" ON "users" ("id")`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users" ("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`)).
+		WithArgs(int64(1), "Jane").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	upserter := NewValidatingUpserter(NewHashIndexedUpserter(db), db)
+	ctx := context.Background()
+	if err := upserter.Upsert(ctx, "users", []string{"id", "name"}, [][]any{{int64(1), "Janet"}}, []string{"id"}); err == nil {
+		t.Fatal("expected validation error, got nil")
+	}
+	// The second call reuses the introspected columns.
+	if err := upserter.Upsert(ctx, "users", []string{"id", "name"}, [][]any{{int64(1), "Jane"}}, []string{"id"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}